@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
-	"io"
 	"log"
 	"os"
 
@@ -15,31 +15,13 @@ func init() {
 	log.SetPrefix("marc2marc: ")
 }
 
-func detectFormat(f *os.File) (marc.Format, error) {
-	sniff := make([]byte, 64)
-	_, err := f.Read(sniff)
-	if err != nil {
-		log.Fatal(err)
-	}
-	format := marc.DetectFormat(sniff)
-
-	// rewind reader
-	_, err = f.Seek(0, 0)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	switch format {
-	case marc.MARC, marc.LineMARC, marc.MARCXML:
-		return format, nil
-	default:
-		return format, errors.New("unknown MARC format")
-	}
-}
-
 func main() {
-	in := flag.String("i", "", "input file")
-	f := flag.String("f", "", "output format: (m)arc, (l)ine-marc, marc(x)ml")
+	in := flag.String("i", "", "input file (may be gzip, bzip2 or zstd compressed)")
+	out := flag.String("o", "", "output file, compressed if ending in .gz or .zst (default stdout)")
+	f := flag.String("f", "", "output format: (m)arc, (l)ine-marc, marc(x)ml, or name of registered format")
+	j := flag.Int("j", 1, "number of parallel decoding workers")
+	skip := flag.Int("skip", 0, "skip the first N records")
+	n := flag.Int("n", 0, "convert at most N records (default all)")
 
 	flag.Parse()
 
@@ -54,10 +36,12 @@ func main() {
 	}
 	defer inF.Close()
 
-	from, err := detectFormat(inF)
+	dec, err := marc.NewAutoDecoder(inF)
 	if err != nil {
 		log.Fatalf("%s: %v", inF.Name(), err)
 	}
+	defer dec.Close()
+	from := dec.Format()
 
 	var to marc.Format
 	switch *f {
@@ -68,27 +52,72 @@ func main() {
 	case "x", "X":
 		to = marc.MARCXML
 	default:
-		log.Println("illegal option for flag -f")
-		flag.Usage()
-		os.Exit(1)
+		var ok bool
+		if to, ok = marc.FormatByName(*f); !ok {
+			log.Println("illegal option for flag -f")
+			flag.Usage()
+			os.Exit(1)
+		}
 	}
 
-	if from == to {
+	c := marc.CompressionFromExt(*out)
+	if from == to && c == dec.Compression() {
 		log.Println("nothing to do; input format same as output format")
 		os.Exit(1)
 	}
 
-	dec := marc.NewDecoder(inF, from)
-	enc := marc.NewEncoder(os.Stdout, to)
-
-	for rec, err := dec.Decode(); err != io.EOF; rec, err = dec.Decode() {
+	if err := marc.CheckCompression(c); err != nil {
+		log.Fatal(err)
+	}
+	outF := os.Stdout
+	if *out != "" {
+		outF, err = os.Create(*out)
 		if err != nil {
+			log.Fatal(err)
+		}
+		defer outF.Close()
+	}
+
+	w, err := marc.NewCompressor(outF, c)
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := marc.NewEncoder(w, to)
+
+	// Skipping and limiting in the sink, rather than wrapping dec in
+	// marc.Skip and marc.Limit, keeps the parallel decoding of binary MARC.
+	errDone := errors.New("done")
+	seen, written := 0, 0
+	err = marc.Pipeline{Workers: *j}.Run(context.Background(), dec, func(rec *marc.Record, err error) error {
+		var recErr *marc.RecordError
+		if errors.As(err, &recErr) {
 			log.Println(err)
-			continue
+			return nil
+		} else if err != nil {
+			return err // reading the input failed
+		}
+		if seen++; seen <= *skip {
+			return nil
 		}
-		if err = enc.Encode(rec); err != nil {
+		if err := enc.Encode(rec); err != nil {
 			log.Println(err)
 		}
+		if written++; written == *n {
+			return errDone
+		}
+		return nil
+	})
+	if err == errDone {
+		err = nil
+	}
+	// Write out the records converted before any read error.
+	if err := enc.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if err != nil {
+		log.Fatal(err)
 	}
-	enc.Flush()
 }
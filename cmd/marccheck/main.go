@@ -1,24 +1,76 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/boutros/marc"
+	"github.com/boutros/marc/spec"
 )
 
+// recordIssues are the issues of a record, as written with -format json.
+type recordIssues struct {
+	Record int                    `json:"record"`
+	ID     string                 `json:"id,omitempty"`
+	Issues []spec.ValidationIssue `json:"issues"`
+}
+
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("marccheck: ")
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: marccheck <marcdatabase>\n")
+	j := flag.Int("j", 1, "number of parallel decoding and validation workers")
+	validate := flag.Bool("validate", false, "validate records against the MARC 21 bibliographic format")
+	dicts := flag.String("dict", "", "extend the format with field definitions from these files, comma-separated (ex. normarc.json,local.json)")
+	format := flag.String("format", "text", "validation report format: text, or json (one line per record with issues)")
+	rulesFile := flag.String("rules", "", "check records against the local rules in this file")
+	quiet := flag.Bool("q", false, "only print the summary of the validation")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marccheck [options...] <marcdatabase>\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(flag.Args()) < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown report format: %q", *format)
+	}
 
-	f, err := os.Open(os.Args[1])
+	var validator *spec.Validator
+	if *validate {
+		dict := spec.MARC21()
+		if *dicts != "" {
+			for _, name := range strings.Split(*dicts, ",") {
+				ext, err := spec.LoadFile(name)
+				if err != nil {
+					log.Fatal(err)
+				}
+				dict = dict.Extend(ext)
+			}
+		}
+		validator = spec.NewValidator(dict)
+	}
+	var rules spec.Rules
+	if *rulesFile != "" {
+		var err error
+		rules, err = spec.LoadRules(*rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(flag.Args()[0])
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -28,37 +80,100 @@ func main() {
 	}
 	size := stats.Size()
 
-	// Detect format
-	sniff := make([]byte, 64)
-	_, err = f.Read(sniff)
+	dec, err := marc.NewAutoDecoder(f)
 	if err != nil {
 		log.Fatal(err)
 	}
-	format := marc.DetectFormat(sniff)
-	switch format {
-	case marc.MARC, marc.LineMARC, marc.MARCXML:
-		break
-	default:
-		log.Fatal("Unknown MARC format")
-	}
+	defer dec.Close()
 
-	// rewind reader
-	_, err = f.Seek(0, 0)
-	if err != nil {
-		log.Fatal(err)
-	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
 
-	dec := marc.NewDecoder(f, format)
 	c := 0
+	invalid := 0
+	counts := make(map[string]int)     // issues by severity and kind
+	ruleCounts := make(map[string]int) // violations by rule
 	start := time.Now()
 
-	for _, err := dec.Decode(); err != io.EOF; _, err = dec.Decode() {
+	// Records are validated by the pipeline workers; the sink picks up the
+	// issues of each record in order, and only counts and reports them.
+	var found sync.Map // *marc.Record -> []spec.ValidationIssue
+	p := marc.Pipeline{Workers: *j}
+	if validator != nil || rules != nil {
+		p.Transform = func(r *marc.Record) (*marc.Record, error) {
+			var issues []spec.ValidationIssue
+			if validator != nil {
+				issues = validator.Validate(r)
+			}
+			issues = append(issues, rules.Check(r)...)
+			if len(issues) > 0 {
+				found.Store(r, issues)
+			}
+			return r, nil
+		}
+	}
+
+	err = p.Run(context.Background(), dec, func(r *marc.Record, err error) error {
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 		c++
+		v, ok := found.LoadAndDelete(r)
+		if !ok {
+			return nil
+		}
+		issues := v.([]spec.ValidationIssue)
+		invalid++
+		for _, issue := range issues {
+			if issue.Rule != "" {
+				ruleCounts[issue.Rule]++
+				continue
+			}
+			counts[issue.Severity.String()+" "+issue.Kind]++
+		}
+		if *quiet {
+			return nil
+		}
+		id := r.Key("001")
+		if *format == "json" {
+			return enc.Encode(recordIssues{Record: c - 1, ID: id, Issues: issues})
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(out, "%d\t%s\t%s\n", c-1, id, issue)
+		}
+		return nil
+	})
+	if err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
+
+	// With a JSON report on stdout, the summary goes to stderr.
+	summary := out
+	if *format == "json" && !*quiet {
+		out.Flush()
+		summary = bufio.NewWriter(os.Stderr)
+		defer summary.Flush()
+	}
+	if validator != nil || rules != nil {
+		if !*quiet && *format == "text" && invalid > 0 {
+			fmt.Fprintln(summary)
+		}
+		kinds := make([]string, 0, len(counts))
+		for k := range counts {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		for _, k := range kinds {
+			fmt.Fprintf(summary, "%8d %s\n", counts[k], k)
+		}
+		for _, rule := range rules {
+			fmt.Fprintf(summary, "%8d %s rule %s\n", ruleCounts[rule.Name], rule.Severity, rule.Name)
+		}
+		fmt.Fprintf(summary, "Records with issues: %d\n", invalid)
 	}
-	fmt.Printf("Done in %s\n", time.Now().Sub(start))
-	fmt.Printf("Number of records: %d\n", c)
-	fmt.Printf("Average parsing speed: %.2f MB/s", float64(size)/time.Now().Sub(start).Seconds()/1048576)
+	fmt.Fprintf(summary, "Done in %s\n", time.Now().Sub(start))
+	fmt.Fprintf(summary, "Number of records: %d\n", c)
+	fmt.Fprintf(summary, "Average parsing speed: %.2f MB/s\n", float64(size)/time.Now().Sub(start).Seconds()/1048576)
 }
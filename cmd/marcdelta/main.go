@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/boutros/marc"
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("marcdelta: ")
+}
+
+// output is an encoder writing to a file, compressed by its extension.
+type output struct {
+	f   *os.File
+	w   io.WriteCloser
+	enc *marc.Encoder
+	n   int
+}
+
+func create(name string, format marc.Format) (*output, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w, err := marc.NewCompressor(f, marc.CompressionFromExt(name))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &output{f: f, w: w, enc: marc.NewEncoder(w, format)}, nil
+}
+
+func (o *output) Encode(r *marc.Record) error {
+	o.n++
+	return o.enc.Encode(r)
+}
+
+func (o *output) Close() error {
+	if err := o.enc.Flush(); err != nil {
+		return err
+	}
+	if err := o.w.Close(); err != nil {
+		return err
+	}
+	return o.f.Close()
+}
+
+// openIndexed opens the old dump for lookups by key, using the index file
+// written by marcindex if there is one.
+func openIndexed(name, keyTag string) (*marc.IndexedReader, *marc.MappedFile, error) {
+	m, err := marc.OpenMapped(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var idx *marc.Index
+	if f, err := os.Open(name + ".idx"); err == nil {
+		idx, err = marc.LoadIndex(f)
+		f.Close()
+		if err != nil {
+			m.Close()
+			return nil, nil, fmt.Errorf("%s.idx: %v", name, err)
+		}
+	}
+	if idx == nil || !slices.Contains(idx.KeyTags, keyTag) || indexedSize(idx) != int64(m.Len()) {
+		if idx, err = marc.BuildIndex(io.NewSectionReader(m, 0, int64(m.Len())), keyTag); err != nil {
+			m.Close()
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return marc.NewIndexedReader(m, idx), m, nil
+}
+
+// indexedSize returns the size of the file indexed by idx, to detect stale
+// index files.
+func indexedSize(idx *marc.Index) int64 {
+	n := idx.Len()
+	if n == 0 {
+		return 0
+	}
+	return idx.Offsets[n-1] + int64(idx.Lengths[n-1])
+}
+
+func main() {
+	var (
+		key    = flag.String("key", "001", "tag identifying records; subfield $a is used for data fields")
+		sorted = flag.Bool("sorted", false, "both files are sorted by key; otherwise old must be binary MARC, and is indexed")
+		f      = flag.String("f", "m", "output format: (m)arc, (l)ine-marc, marc(x)ml, or name of registered format")
+		newOut = flag.String("new", "new.mrc", "output file for new records")
+		chOut  = flag.String("changed", "changed.mrc", "output file for changed records")
+		delOut = flag.String("deleted", "deleted.mrc", "output file for deleted record stubs")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcdelta [options...] old new\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var format marc.Format
+	switch *f {
+	case "m", "M":
+		format = marc.MARC
+	case "l", "L":
+		format = marc.LineMARC
+	case "x", "X":
+		format = marc.MARCXML
+	default:
+		var ok bool
+		if format, ok = marc.FormatByName(*f); !ok {
+			log.Println("illegal option for flag -f")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	newF, err := os.Open(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer newF.Close()
+	newDec, err := marc.NewAutoDecoder(newF)
+	if err != nil {
+		log.Fatalf("%s: %v", newF.Name(), err)
+	}
+	defer newDec.Close()
+
+	// Check all outputs before creating any, not to leave some behind.
+	for _, name := range []string{*newOut, *chOut, *delOut} {
+		if err := marc.CheckCompression(marc.CompressionFromExt(name)); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+	outs := make(map[marc.Op]*output)
+	for op, name := range map[marc.Op]string{marc.Added: *newOut, marc.Changed: *chOut, marc.Removed: *delOut} {
+		if outs[op], err = create(name, format); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	emit := func(op marc.Op, old, cur *marc.Record) error {
+		r := cur
+		if op == marc.Removed {
+			r = marc.DeleteStub(old, *key)
+		}
+		return outs[op].Encode(r)
+	}
+
+	if *sorted {
+		oldF, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer oldF.Close()
+		oldDec, err := marc.NewAutoDecoder(oldF)
+		if err != nil {
+			log.Fatalf("%s: %v", oldF.Name(), err)
+		}
+		defer oldDec.Close()
+		err = marc.SortedDelta(oldDec, newDec, *key, emit)
+	} else {
+		ir, m, err2 := openIndexed(flag.Arg(0), *key)
+		if err2 != nil {
+			log.Fatal(err2)
+		}
+		defer m.Close()
+		err = marc.IndexedDelta(ir, newDec, *key, emit)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, o := range outs {
+		if err := o.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("%d new, %d changed, %d deleted", outs[marc.Added].n, outs[marc.Changed].n, outs[marc.Removed].n)
+}
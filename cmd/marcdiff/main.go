@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/boutros/marc"
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("marcdiff: ")
+}
+
+// open returns a decoder for the named file.
+// input is a decoder over an open file.
+type input struct {
+	*marc.Decoder
+	f *os.File
+}
+
+// Close closes the decoder and the file.
+func (in *input) Close() error {
+	err := in.Decoder.Close()
+	if ferr := in.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+func open(name string) (*input, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := marc.NewAutoDecoder(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &input{dec, f}, nil
+}
+
+// maskLeader blanks out record length and base address of data, which
+// change whenever the record does.
+func maskLeader(r *marc.Record) {
+	if len(r.Leader) == 24 {
+		r.Leader = "00000" + r.Leader[5:12] + "00000" + r.Leader[17:]
+	}
+}
+
+func main() {
+	var (
+		key       = flag.String("key", "001", "tag identifying records; subfield $a is used for data fields")
+		patchFile = flag.String("patch", "", "write patch to file, for use with marcpatch")
+		useColors = flag.Bool("color", true, "use colored terminal output")
+		quiet     = flag.Bool("q", false, "only print summary")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcdiff [options...] old new\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Read all records of the old file, indexed by key.
+	oldDec, err := open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		oldRecs = make(map[string]*marc.Record)
+		oldKeys []string // in input order
+	)
+	for r, err := range oldDec.All() {
+		if err != nil {
+			log.Fatalf("%s: %v", flag.Arg(0), err)
+		}
+		k := r.Key(*key)
+		if k == "" {
+			log.Printf("%s: record without key %s skipped", flag.Arg(0), *key)
+			continue
+		}
+		if _, ok := oldRecs[k]; ok {
+			log.Printf("%s: duplicate key %s %s skipped", flag.Arg(0), *key, k)
+			continue
+		}
+		maskLeader(r)
+		oldRecs[k] = r
+		oldKeys = append(oldKeys, k)
+	}
+	oldDec.Close()
+
+	var (
+		pw    *bufio.Writer
+		pf    *os.File
+		enc   *json.Encoder
+		out   = bufio.NewWriter(os.Stdout)
+		bold  = ""
+		reset = ""
+	)
+	if *useColors {
+		bold, reset = "\x1b[1m", "\x1b[0m"
+	}
+	if *patchFile != "" {
+		pf, err = os.Create(*patchFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pw = bufio.NewWriter(pf)
+		enc = json.NewEncoder(pw)
+	}
+
+	newDec, err := open(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer newDec.Close()
+
+	var compared, changed, onlyNew, onlyOld int
+	seen := make(map[string]bool)
+	for r, err := range newDec.All() {
+		if err != nil {
+			log.Fatalf("%s: %v", flag.Arg(1), err)
+		}
+		k := r.Key(*key)
+		if k == "" {
+			log.Printf("%s: record without key %s skipped", flag.Arg(1), *key)
+			continue
+		}
+		if seen[k] {
+			log.Printf("%s: duplicate key %s %s skipped", flag.Arg(1), *key, k)
+			continue
+		}
+		seen[k] = true
+		old, ok := oldRecs[k]
+		if !ok {
+			onlyNew++
+			if !*quiet {
+				fmt.Fprintf(out, "%s%s %s%s only in %s\n\n", bold, *key, k, reset, flag.Arg(1))
+			}
+			continue
+		}
+		compared++
+		maskLeader(r)
+		changes := marc.Diff(old, r)
+		if len(changes) == 0 {
+			continue
+		}
+		changed++
+		if !*quiet {
+			fmt.Fprintf(out, "%s%s %s%s\n", bold, *key, k, reset)
+			marc.DumpChanges(out, changes, *useColors)
+			fmt.Fprintln(out)
+		}
+		if enc != nil {
+			if err := enc.Encode(marc.Patch{KeyTag: *key, Key: k, Changes: changes}); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	for _, k := range oldKeys {
+		if !seen[k] {
+			onlyOld++
+			if !*quiet {
+				fmt.Fprintf(out, "%s%s %s%s only in %s\n\n", bold, *key, k, reset, flag.Arg(0))
+			}
+		}
+	}
+	if err := out.Flush(); err != nil {
+		log.Fatal(err)
+	}
+
+	if pw != nil {
+		if err := pw.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err := pf.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	log.Printf("%d records compared, %d changed, %d only in %s, %d only in %s",
+		compared, changed, onlyOld, flag.Arg(0), onlyNew, flag.Arg(1))
+}
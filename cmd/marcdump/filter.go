@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+// fieldFilter selects fields by tag pattern, and optionally subfields by
+// code, as in "245ab", "6XX" or "600-651a".
+type fieldFilter struct {
+	pattern string // see marc.MatchTag
+	codes   string // all subfields if empty
+}
+
+func (f fieldFilter) String() string {
+	return f.pattern + f.codes
+}
+
+// parseFilter parses a comma-separated list of field filters.
+func parseFilter(s string) ([]fieldFilter, error) {
+	var res []fieldFilter
+	for _, e := range strings.Split(s, ",") {
+		n := 3
+		if len(e) > 3 && e[3] == '-' {
+			n = 7 // tag range
+		}
+		if len(e) < n {
+			return nil, fmt.Errorf("invalid field filter %q: should be a tag, tag pattern like 6XX or tag range like 600-651, plus optional subfield codes", e)
+		}
+		res = append(res, fieldFilter{pattern: e[:n], codes: e[n:]})
+	}
+	return res, nil
+}
+
+func (f fieldFilter) selects(code string) bool {
+	return f.codes == "" || strings.Contains(f.codes, code)
+}
+
+// filterRecord returns a record with the leader of r, and the fields and
+// subfields of r selected by any of the filters. It returns nil if no field
+// is selected.
+func filterRecord(r *marc.Record, filters []fieldFilter) *marc.Record {
+	res := marc.NewRecord()
+	res.Leader = r.Leader
+	for _, cf := range r.CtrlFields {
+		for _, f := range filters {
+			if marc.MatchTag(f.pattern, cf.Tag) {
+				res.CtrlFields = append(res.CtrlFields, cf)
+				break
+			}
+		}
+	}
+	for _, df := range r.DataFields {
+		var matching []fieldFilter
+		for _, f := range filters {
+			if marc.MatchTag(f.pattern, df.Tag) {
+				matching = append(matching, f)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		sel := df
+		sel.SubFields = nil
+		for _, sf := range df.SubFields {
+			for _, f := range matching {
+				if f.selects(sf.Code) {
+					sel.SubFields = append(sel.SubFields, sf)
+					break
+				}
+			}
+		}
+		if len(sel.SubFields) > 0 {
+			res.AddDField(sel)
+		}
+	}
+	if len(res.CtrlFields) == 0 && len(res.DataFields) == 0 {
+		return nil
+	}
+	return res
+}
+
+// values returns the values in r selected by the filter.
+func (f fieldFilter) values(r *marc.Record) []string {
+	var res []string
+	if f.pattern == "LDR" {
+		return []string{r.Leader}
+	}
+	for _, cf := range r.CtrlFields {
+		if marc.MatchTag(f.pattern, cf.Tag) {
+			res = append(res, cf.Value)
+		}
+	}
+	for _, df := range r.DataFields {
+		if !marc.MatchTag(f.pattern, df.Tag) {
+			continue
+		}
+		for _, sf := range df.SubFields {
+			if f.selects(sf.Code) {
+				res = append(res, sf.Value)
+			}
+		}
+	}
+	return res
+}
+
+var tsvReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// tsvField joins values for a TSV column, replacing tabs and line breaks.
+func tsvField(vals []string) string {
+	return tsvReplacer.Replace(strings.Join(vals, "|"))
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boutros/marc"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		s       string
+		skip, n int
+		err     bool
+	}{
+		{"0", 0, 1, false},
+		{"100-199", 100, 100, false},
+		{"5-5", 5, 1, false},
+		{"7-", 7, 0, false},
+		{"5-3", 0, 0, true},
+		{"-3", 0, 0, true},
+		{"x", 0, 0, true},
+		{"1-x", 0, 0, true},
+		{"", 0, 0, true},
+	}
+	for _, tt := range tests {
+		skip, n, err := parseRange(tt.s)
+		if (err != nil) != tt.err || skip != tt.skip || n != tt.n {
+			t.Errorf("parseRange(%q) => %d, %d, %v; want %d, %d, error %v", tt.s, skip, n, err, tt.skip, tt.n, tt.err)
+		}
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "ids.txt")
+	if err := os.WriteFile(name, []byte("10\n 11 \r\n\n12\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		s    string
+		want map[string]bool
+	}{
+		{"1", map[string]bool{"1": true}},
+		{"1, 2,,3", map[string]bool{"1": true, "2": true, "3": true}},
+		{"@" + name, map[string]bool{"10": true, "11": true, "12": true}},
+	}
+	for _, tt := range tests {
+		got, err := parseIDs(tt.s)
+		if err != nil {
+			t.Errorf("parseIDs(%q) => %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIDs(%q) => %v; want %v", tt.s, got, tt.want)
+		}
+	}
+	if _, err := parseIDs("@" + name + ".missing"); err == nil {
+		t.Error("parseIDs of missing file => no error")
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []fieldFilter
+	}{
+		{"245", []fieldFilter{{"245", ""}}},
+		{"100b,245ac", []fieldFilter{{"100", "b"}, {"245", "ac"}}},
+		{"6XX", []fieldFilter{{"6XX", ""}}},
+		{"600-651a", []fieldFilter{{"600-651", "a"}}},
+		{"LDR,001", []fieldFilter{{"LDR", ""}, {"001", ""}}},
+	}
+	for _, tt := range tests {
+		got, err := parseFilter(tt.s)
+		if err != nil {
+			t.Errorf("parseFilter(%q) => %v", tt.s, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFilter(%q) => %v; want %v", tt.s, got, tt.want)
+		}
+	}
+	for _, s := range []string{"", "24", "245,", "600-65"} {
+		if _, err := parseFilter(s); err == nil {
+			t.Errorf("parseFilter(%q) => no error", s)
+		}
+	}
+}
+
+func filterTestRecord() *marc.Record {
+	r := marc.NewRecord()
+	r.Leader = "00000cam  2200000 a 4500"
+	r.CtrlFields = marc.CFields{{Tag: "001", Value: "1"}, {Tag: "008", Value: "871001"}}
+	r.DataFields = marc.DFields{
+		marc.NewDField("100").AddSubField("a", "Doe, Jane").AddSubField("d", "1950-"),
+		marc.NewDField("245").AddSubField("a", "Title").AddSubField("b", "sub\ttitle"),
+		marc.NewDField("600").AddSubField("a", "Smith").AddSubField("x", "Biography"),
+		marc.NewDField("650").AddSubField("a", "Cats").AddSubField("2", "lcsh"),
+		marc.NewDField("651").AddSubField("a", "Norway"),
+		marc.NewDField("700").AddSubField("a", "Roe,\nRichard"),
+	}
+	return r
+}
+
+func TestFilterRecord(t *testing.T) {
+	r := filterTestRecord()
+	tests := []struct {
+		filter string
+		want   []string // tags of the control fields, then data fields with their subfield codes
+	}{
+		{"001", []string{"001"}},
+		{"245", []string{"245ab"}},
+		{"245b,100a", []string{"100a", "245b"}},
+		{"6XXa", []string{"600a", "650a", "651a"}},
+		{"600-650", []string{"600ax", "650a2"}},
+		{"650a,650x,6XX2", []string{"650a2"}},
+		{"00X,245a", []string{"001", "008", "245a"}},
+		{"245x", nil},
+		{"999", nil},
+	}
+	for _, tt := range tests {
+		filters, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := filterRecord(r, filters)
+		var got []string
+		if res != nil {
+			if res.Leader != r.Leader {
+				t.Errorf("filterRecord(%s) => leader %q; want %q", tt.filter, res.Leader, r.Leader)
+			}
+			for _, cf := range res.CtrlFields {
+				got = append(got, cf.Tag)
+			}
+			for _, df := range res.DataFields {
+				codes := df.Tag
+				for _, sf := range df.SubFields {
+					codes += sf.Code
+				}
+				got = append(got, codes)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterRecord(%s) => %v; want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestFilterValuesTSV(t *testing.T) {
+	r := filterTestRecord()
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{"LDR", "00000cam  2200000 a 4500"},
+		{"001", "1"},
+		{"100", "Doe, Jane|1950-"},
+		{"245b", "sub title"},
+		{"6XXa", "Smith|Cats|Norway"},
+		{"600-651x", "Biography"},
+		{"700a", "Roe, Richard"},
+		{"500", ""},
+	}
+	for _, tt := range tests {
+		filters, err := parseFilter(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tsvField(filters[0].values(r)); got != tt.want {
+			t.Errorf("tsvField(values of %s) => %q; want %q", tt.filter, got, tt.want)
+		}
+	}
+	if got := tsvField([]string{"a\tb", "c\r\nd"}); got != "a b|c  d" {
+		t.Errorf("tsvField => %q; want %q", got, "a b|c  d")
+	}
+}
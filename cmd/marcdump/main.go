@@ -1,21 +1,70 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/boutros/marc"
 )
 
+// parseRange parses an ordinal range, "N-M", "N-" or "N", counting from 0,
+// and returns the first ordinal and the number of records (0 for all).
+func parseRange(s string) (skip, n int, err error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if skip, err = strconv.Atoi(from); err != nil || skip < 0 {
+		return 0, 0, fmt.Errorf("invalid record range %q", s)
+	}
+	if !isRange {
+		return skip, 1, nil
+	}
+	if to == "" {
+		return skip, 0, nil
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil || last < skip {
+		return 0, 0, fmt.Errorf("invalid record range %q", s)
+	}
+	return skip, last - skip + 1, nil
+}
+
+// parseIDs parses a comma-separated list of ids, or reads them from a file,
+// one per line, if s starts with @.
+func parseIDs(s string) (map[string]bool, error) {
+	var ids []string
+	if name, ok := strings.CutPrefix(s, "@"); ok {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		ids = strings.Split(string(b), "\n")
+	} else {
+		ids = strings.Split(s, ",")
+	}
+	res := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" {
+			res[id] = true
+		}
+	}
+	return res, nil
+}
+
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("marcdump: ")
 	var (
 		useColors = flag.Bool("color", true, "use colored terminal output")
-		//filter    = flag.String("filter", "", "only print specified fields, ex.: 100b,245a")
+		specList  = flag.String("spec", "", "only print values selected by these MARCspecs, ex.: '245$a,6XX$a{$2=\\lcsh}'")
+		filter    = flag.String("filter", "", "only print specified fields, ex.: 100b,245a,6XX,600-651a")
+		records   = flag.String("records", "", "only print records in ordinal range, counting from 0, ex.: 100-199")
+		idList    = flag.String("ids", "", "only print records with these 001 values, comma-separated, or one per line in @file")
+		n         = flag.Int("n", 0, "print at most N records (default all)")
+		tsv       = flag.Bool("tsv", false, "print the values selected by -filter and -spec as tab-separated values, one record per line")
 	)
 
 	flag.Usage = func() {
@@ -30,37 +79,117 @@ func main() {
 		os.Exit(1)
 	}
 
-	f, err := os.Open(flag.Args()[0])
-	if err != nil {
-		log.Fatal(err)
+	var (
+		specs   []*marc.MARCSpec
+		filters []fieldFilter
+		ids     map[string]bool
+		err     error
+	)
+	if *specList != "" {
+		if specs, err = marc.ParseMARCSpecs(*specList); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *filter != "" {
+		if filters, err = parseFilter(*filter); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *tsv && len(specs) == 0 && len(filters) == 0 {
+		log.Fatal("-tsv needs -filter or -spec to select columns")
+	}
+	if *idList != "" {
+		if ids, err = parseIDs(*idList); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	// Detect format
-	sniff := make([]byte, 64)
-	_, err = f.Read(sniff)
+	f, err := os.Open(flag.Args()[0])
 	if err != nil {
 		log.Fatal(err)
 	}
-	format := marc.DetectFormat(sniff)
-	switch format {
-	case marc.MARC, marc.LineMARC, marc.MARCXML:
-		break
-	default:
-		log.Fatal("Unknown MARC format")
-	}
 
-	// rewind reader
-	_, err = f.Seek(0, 0)
+	dec, err := marc.NewAutoDecoder(f)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer dec.Close()
 
-	dec := marc.NewDecoder(f, format)
-	for r, err := dec.Decode(); err != io.EOF; r, err = dec.Decode() {
+	var src marc.RecordReader = dec
+	if *records != "" {
+		skip, count, err := parseRange(*records)
 		if err != nil {
 			log.Fatal(err)
 		}
-		r.DumpTo(os.Stdout, *useColors)
+		src = marc.Skip(src, skip)
+		if count > 0 {
+			src = marc.Limit(src, count)
+		}
+	}
+	if ids != nil {
+		src = marc.Filter(src, func(r *marc.Record) bool {
+			f, _ := r.GetCField("001")
+			return ids[strings.TrimSpace(f.Value)]
+		})
+	}
+	if *n > 0 {
+		src = marc.Limit(src, *n)
 	}
 
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	bold, reset := "", ""
+	if *useColors {
+		bold, reset = "\x1b[1m", "\x1b[0m"
+	}
+
+	if *tsv {
+		var header []string
+		for _, f := range filters {
+			header = append(header, f.String())
+		}
+		for _, s := range specs {
+			header = append(header, s.String())
+		}
+		fmt.Fprintln(out, strings.Join(header, "\t"))
+	}
+
+	dump := marc.WriterFunc(func(r *marc.Record) error {
+		switch {
+		case *tsv:
+			row := make([]string, 0, len(filters)+len(specs))
+			for _, f := range filters {
+				row = append(row, tsvField(f.values(r)))
+			}
+			for _, s := range specs {
+				row = append(row, tsvField(s.Values(r)))
+			}
+			_, err := fmt.Fprintln(out, strings.Join(row, "\t"))
+			return err
+		case len(filters) > 0 || len(specs) > 0:
+			if len(filters) > 0 {
+				if r := filterRecord(r, filters); r != nil {
+					r.DumpTo(out, *useColors)
+				}
+			}
+			found := false
+			for _, spec := range specs {
+				for _, v := range spec.Values(r) {
+					fmt.Fprintf(out, "%s%s%s %s\n", bold, spec, reset, v)
+					found = true
+				}
+			}
+			if found {
+				fmt.Fprintln(out)
+			}
+		default:
+			r.DumpTo(out, *useColors)
+		}
+		return nil
+	})
+	if _, err := marc.Copy(dump, src); err != nil {
+		out.Flush()
+		log.Fatal(err)
+	}
 }
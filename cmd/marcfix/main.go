@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("marcfix: ")
+}
+
+func main() {
+	out := flag.String("o", "", "output file, compressed if ending in .gz or .zst (default stdout)")
+	names := flag.String("fixers", "", "fixers to apply, comma-separated (default all, see -list)")
+	list := flag.Bool("list", false, "list the fixers and exit")
+	dryRun := flag.Bool("n", false, "only report the changes, without writing the records")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcfix [options...] file\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *list {
+		for _, f := range marc.Fixers() {
+			fmt.Printf("%-12s %s\n", f.Name, f.Description)
+		}
+		return
+	}
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	fixers := marc.Fixers()
+	if *names != "" {
+		fixers = nil
+		for _, name := range strings.Split(*names, ",") {
+			f, ok := marc.LookupFixer(name)
+			if !ok {
+				log.Fatalf("unknown fixer: %q", name)
+			}
+			fixers = append(fixers, f)
+		}
+	}
+
+	inF, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inF.Close()
+	dec, err := marc.NewAutoDecoder(inF)
+	if err != nil {
+		log.Fatalf("%s: %v", inF.Name(), err)
+	}
+	defer dec.Close()
+
+	var w io.WriteCloser
+	var enc *marc.Encoder
+	if !*dryRun {
+		if err := marc.CheckCompression(marc.CompressionFromExt(*out)); err != nil {
+			log.Fatal(err)
+		}
+		outF := os.Stdout
+		if *out != "" {
+			outF, err = os.Create(*out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer outF.Close()
+		}
+		w, err = marc.NewCompressor(outF, marc.CompressionFromExt(*out))
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc = marc.NewEncoder(w, dec.Format())
+	}
+
+	// The changes are reported on stderr, as the records go to stdout.
+	report := bufio.NewWriter(os.Stderr)
+	defer report.Flush()
+
+	var c, fixed int
+	counts := make(map[string]int) // changes by fixer
+	var readErr error
+	for r, err := range dec.All() {
+		var recErr *marc.RecordError
+		if errors.As(err, &recErr) {
+			log.Println(err)
+			continue
+		} else if err != nil {
+			readErr = err
+			break
+		}
+		changes := marc.Fix(r, fixers...)
+		if len(changes) > 0 {
+			fixed++
+			id := r.Key("001")
+			for _, change := range changes {
+				counts[change.Fixer]++
+				fmt.Fprintf(report, "%d\t%s\t%s\n", c, id, change)
+			}
+		}
+		c++
+		if enc == nil {
+			continue
+		}
+		if err := enc.Encode(r); err != nil {
+			log.Println(err)
+		}
+	}
+	if enc != nil {
+		if err = enc.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if readErr != nil {
+		// No summary, as the rest of the file was not read.
+		report.Flush()
+		log.Fatal(readErr)
+	}
+
+	if fixed > 0 {
+		fmt.Fprintln(report)
+	}
+	for _, f := range fixers {
+		fmt.Fprintf(report, "%8d %s\n", counts[f.Name], f.Name)
+	}
+	fmt.Fprintf(report, "Records fixed: %d of %d\n", fixed, c)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/boutros/marc"
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("marcgrep: ")
+}
+
+func main() {
+	var (
+		invert = flag.Bool("v", false, "select records not matching the query")
+		count  = flag.Bool("c", false, "only print the number of matching records")
+		out    = flag.String("o", "", "output file, compressed if ending in .gz or .zst (default stdout)")
+		f      = flag.String("f", "", "output format: (m)arc, (l)ine-marc, marc(x)ml, or name of registered format (default same as input)")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcgrep [options...] query file\n\nOptions:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample query: '041$a ~ nob AND LDR/6 = a'\n")
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	q, err := marc.ParseQuery(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inF, err := os.Open(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inF.Close()
+	dec, err := marc.NewAutoDecoder(inF)
+	if err != nil {
+		log.Fatalf("%s: %v", inF.Name(), err)
+	}
+	defer dec.Close()
+
+	to := dec.Format()
+	switch *f {
+	case "":
+	case "m", "M":
+		to = marc.MARC
+	case "l", "L":
+		to = marc.LineMARC
+	case "x", "X":
+		to = marc.MARCXML
+	default:
+		var ok bool
+		if to, ok = marc.FormatByName(*f); !ok {
+			log.Println("illegal option for flag -f")
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	var (
+		enc *marc.Encoder
+		w   io.WriteCloser
+	)
+	outF := os.Stdout
+	if !*count {
+		if err := marc.CheckCompression(marc.CompressionFromExt(*out)); err != nil {
+			log.Fatal(err)
+		}
+		if *out != "" {
+			outF, err = os.Create(*out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer outF.Close()
+		}
+		w, err = marc.NewCompressor(outF, marc.CompressionFromExt(*out))
+		if err != nil {
+			log.Fatal(err)
+		}
+		enc = marc.NewEncoder(w, to)
+	}
+
+	n := 0
+	var readErr error
+	for r, err := range dec.All() {
+		var recErr *marc.RecordError
+		if errors.As(err, &recErr) {
+			log.Println(err)
+			continue
+		} else if err != nil {
+			readErr = err
+			break
+		}
+		if q.Match(r) == *invert {
+			continue
+		}
+		n++
+		if enc != nil {
+			if err := enc.Encode(r); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	if *count {
+		fmt.Println(n)
+	} else {
+		if err := enc.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if readErr != nil {
+		log.Fatal(readErr)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("marcindex: ")
+	var (
+		build     = flag.Bool("build", false, "build index of file")
+		keys      = flag.String("keys", strings.Join(marc.DefaultIndexKeys, ","), "tags to use as lookup keys when building index")
+		indexFile = flag.String("index", "", "index file (default <file>.idx)")
+		n         = flag.Int("n", -1, "fetch record by ordinal, counting from 0")
+		key       = flag.String("key", "", "fetch records by key, ex.: 001=12345")
+		raw       = flag.Bool("raw", false, "output raw binary MARC instead of pretty printing")
+		useColors = flag.Bool("color", true, "use colored terminal output")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcindex [options...] file\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) == 0 || (!*build && *n < 0 && *key == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+	file := flag.Args()[0]
+	if *indexFile == "" {
+		*indexFile = file + ".idx"
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if *build {
+		var keyTags []string
+		if *keys != "" {
+			keyTags = strings.Split(*keys, ",")
+		}
+		idx, err := marc.BuildIndex(f, keyTags...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out, err := os.Create(*indexFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := idx.Save(out); err != nil {
+			log.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Indexed %d records in %s\n", idx.Len(), *indexFile)
+		return
+	}
+
+	in, err := os.Open(*indexFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	idx, err := marc.LoadIndex(in)
+	in.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", *indexFile, err)
+	}
+	ir := marc.NewIndexedReader(f, idx)
+
+	ords := []int{*n}
+	if *key != "" {
+		tag, value, ok := strings.Cut(*key, "=")
+		if !ok {
+			log.Fatalf("wrong key format: %q (should be tag=value, ex. \"001=12345\")", *key)
+		}
+		ords = idx.Lookup(tag, value)
+		if len(ords) == 0 {
+			log.Fatalf("%s: %v", *key, marc.ErrNotFound)
+		}
+	}
+
+	// Raw records are written as stored, byte for byte, even if they
+	// cannot be decoded.
+	if *raw {
+		for _, i := range ords {
+			b, err := ir.Raw(i)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := os.Stdout.Write(b); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	}
+
+	src := marc.ReaderFunc(func() (*marc.Record, error) {
+		if len(ords) == 0 {
+			return nil, io.EOF
+		}
+		i := ords[0]
+		ords = ords[1:]
+		return ir.Record(i)
+	})
+	dump := marc.WriterFunc(func(r *marc.Record) error {
+		r.DumpTo(os.Stdout, *useColors)
+		return nil
+	})
+	if _, err := marc.Copy(dump, src); err != nil {
+		log.Fatal(err)
+	}
+}
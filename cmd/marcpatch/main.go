@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/boutros/marc"
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("marcpatch: ")
+}
+
+// readPatches reads a patch file written by marcdiff. It returns the patches
+// by key tag and key, and the key tags in order of appearance.
+func readPatches(name string) (map[string][]marc.Patch, []string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var (
+		patches = make(map[string][]marc.Patch)
+		keyTags []string
+		seen    = make(map[string]bool)
+	)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var p marc.Patch
+		if err := dec.Decode(&p); err == io.EOF {
+			return patches, keyTags, nil
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if !seen[p.KeyTag] {
+			seen[p.KeyTag] = true
+			keyTags = append(keyTags, p.KeyTag)
+		}
+		k := p.KeyTag + " " + p.Key
+		patches[k] = append(patches[k], p)
+	}
+}
+
+func main() {
+	out := flag.String("o", "", "output file, compressed if ending in .gz or .zst (default stdout)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcpatch [options...] patchfile file\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	patches, keyTags, err := readPatches(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inF, err := os.Open(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inF.Close()
+	dec, err := marc.NewAutoDecoder(inF)
+	if err != nil {
+		log.Fatalf("%s: %v", inF.Name(), err)
+	}
+	defer dec.Close()
+
+	if err := marc.CheckCompression(marc.CompressionFromExt(*out)); err != nil {
+		log.Fatal(err)
+	}
+	outF := os.Stdout
+	if *out != "" {
+		outF, err = os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer outF.Close()
+	}
+	w, err := marc.NewCompressor(outF, marc.CompressionFromExt(*out))
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := marc.NewEncoder(w, dec.Format())
+
+	var applied, conflicts int
+	var readErr error
+	for r, err := range dec.All() {
+		var recErr *marc.RecordError
+		if errors.As(err, &recErr) {
+			log.Println(err)
+			continue
+		} else if err != nil {
+			readErr = err
+			break
+		}
+		for _, tag := range keyTags {
+			k := tag + " " + r.Key(tag)
+			for _, p := range patches[k] {
+				if err := r.Apply(p.Changes); err != nil {
+					log.Printf("%s: %v", k, err)
+					conflicts++
+				} else {
+					applied++
+				}
+			}
+			delete(patches, k)
+		}
+		if err := enc.Encode(r); err != nil {
+			log.Println(err)
+		}
+	}
+	if err = enc.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		log.Fatal(err)
+	}
+	if readErr != nil {
+		log.Fatal(readErr)
+	}
+
+	unmatched := 0
+	for _, k := range slices.Sorted(maps.Keys(patches)) {
+		log.Printf("%s: no matching record", k)
+		unmatched += len(patches[k])
+	}
+	log.Printf("%d patches applied, %d conflicts, %d without matching record", applied, conflicts, unmatched)
+	if conflicts > 0 || unmatched > 0 {
+		os.Exit(1)
+	}
+}
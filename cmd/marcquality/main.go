@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("marcquality: ")
+}
+
+// parseWeights parses a list of weights, ex. "core=3,links=0", and sets the
+// weights of the named criteria. Criteria with weight 0 are left out.
+func parseWeights(s string, criteria []marc.QualityCriterion) ([]marc.QualityCriterion, error) {
+	for _, kv := range strings.Split(s, ",") {
+		name, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		w, err := strconv.ParseFloat(v, 64)
+		if !ok || err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q", kv)
+		}
+		found := false
+		for i := range criteria {
+			if criteria[i].Name == name {
+				criteria[i].Weight = w
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown criterion %q", name)
+		}
+	}
+	res := criteria[:0]
+	for _, c := range criteria {
+		if c.Weight > 0 {
+			res = append(res, c)
+		}
+	}
+	return res, nil
+}
+
+// formatScore formats a criterion score, leaving it empty if the criterion
+// does not apply.
+func formatScore(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+func writeSummary(w io.Writer, s *marc.QualitySummary, criteria []marc.QualityCriterion) {
+	fmt.Fprintf(w, "Number of records: %d\nMean score: %.1f\n\n", s.Records, s.Mean())
+
+	fmt.Fprintf(w, "%-12s %6s %6s %8s\n", "Criterion", "Weight", "Mean", "Records")
+	for i, c := range criteria {
+		m, n := s.CriterionMean(i)
+		fmt.Fprintf(w, "%-12s %6g %6s %8d\n", c.Name, c.Weight, formatScore(m), n)
+	}
+
+	maxCount := 0
+	for _, n := range s.Histogram {
+		maxCount = max(maxCount, n)
+	}
+	fmt.Fprintf(w, "\n%-7s %8s\n", "Score", "Records")
+	for i, n := range s.Histogram {
+		bucket := fmt.Sprintf("%d-%d", i*10, i*10+9)
+		if i == len(s.Histogram)-1 {
+			bucket = "90-100"
+		}
+		fmt.Fprintf(w, "%-7s %8d", bucket, n)
+		if n > 0 {
+			fmt.Fprintf(w, " %s", strings.Repeat("#", (n*50+maxCount-1)/maxCount))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func main() {
+	var (
+		weights = flag.String("weights", "", "weights of the criteria core, encoding, links, 008 and subjects; 0 leaves a criterion out (ex. 'core=5,links=0')")
+		core    = flag.String("core", "020,100,245,260-264,300,6XX", "core fields, as tags or tag patterns")
+		vocabs  = flag.String("vocabularies", "", "subject vocabularies accepted in $2 of subjects with 2nd indicator 7, comma-separated (default any)")
+		keyTag  = flag.String("key", "001", "tag of the field identifying records in the CSV output")
+		out     = flag.String("o", "", "write the score of each record as CSV to this file")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcquality [options...] file\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if len(flag.Args()) != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var vocabularies []string
+	if *vocabs != "" {
+		vocabularies = strings.Split(*vocabs, ",")
+	}
+	criteria := marc.DefaultQualityCriteria()
+	for i, c := range criteria {
+		switch c.Name {
+		case "core":
+			criteria[i].Score = marc.CoreFieldsScore(strings.Split(*core, ",")...)
+		case "subjects":
+			criteria[i].Score = marc.SubjectVocabularyScore(vocabularies...)
+		}
+	}
+	if *weights != "" {
+		var err error
+		if criteria, err = parseWeights(*weights, criteria); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	inF, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer inF.Close()
+	dec, err := marc.NewAutoDecoder(inF)
+	if err != nil {
+		log.Fatalf("%s: %v", inF.Name(), err)
+	}
+	defer dec.Close()
+
+	var cw *csv.Writer
+	if *out != "" {
+		outF, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer outF.Close()
+		cw = csv.NewWriter(outF)
+		header := []string{"record", "id", "score"}
+		for _, c := range criteria {
+			header = append(header, c.Name)
+		}
+		cw.Write(header)
+	}
+
+	var summary marc.QualitySummary
+	i := 0
+	var readErr error
+	for r, err := range dec.All() {
+		var recErr *marc.RecordError
+		if errors.As(err, &recErr) {
+			log.Println(err)
+			continue
+		} else if err != nil {
+			readErr = err
+			break
+		}
+		qs := marc.ScoreQuality(r, criteria)
+		summary.Add(qs)
+		if cw != nil {
+			row := []string{strconv.Itoa(i), r.Key(*keyTag), strconv.FormatFloat(qs.Total, 'f', 1, 64)}
+			for _, v := range qs.Scores {
+				row = append(row, formatScore(v))
+			}
+			cw.Write(row)
+		}
+		i++
+	}
+	if cw != nil {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if readErr != nil {
+		log.Fatal(readErr)
+	}
+
+	writeSummary(os.Stdout, &summary, criteria)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+// fixedValueStats counts a value at a fixed-field position, in each file.
+type fixedValueStats struct {
+	Value  string `json:"value"`
+	Valid  bool   `json:"valid"`
+	Counts []int  `json:"counts"`
+}
+
+type fixedPositionStats struct {
+	Tag      string             `json:"tag"`
+	Layout   string             `json:"layout,omitempty"`
+	Position string             `json:"position"`
+	Name     string             `json:"name,omitempty"`
+	Totals   []int              `json:"totals"` // occurrences of the position in each file
+	Values   []*fixedValueStats `json:"values"` // ordered by value
+
+	start  int
+	values map[string]*fixedValueStats
+}
+
+// fixedProfile is the distribution of values at each position of the leader,
+// 006, 007 and 008, in one or more files.
+type fixedProfile struct {
+	Files     []string              `json:"files"`
+	Records   []int                 `json:"records"`
+	Positions []*fixedPositionStats `json:"positions"`
+
+	positions map[string]*fixedPositionStats
+}
+
+func newFixedProfile(files []string) *fixedProfile {
+	return &fixedProfile{
+		Files:     files,
+		Records:   make([]int, len(files)),
+		positions: make(map[string]*fixedPositionStats),
+	}
+}
+
+// count adds the fixed values of r to the counts of file i.
+func (p *fixedProfile) count(i int, r *marc.Record) {
+	p.Records[i]++
+	for _, v := range r.FixedValues() {
+		key := v.Tag + "/" + v.Layout + "/" + v.Position.String()
+		ps, ok := p.positions[key]
+		if !ok {
+			ps = &fixedPositionStats{
+				Tag:      v.Tag,
+				Layout:   v.Layout,
+				Position: v.Position.String(),
+				Name:     v.Position.Name,
+				Totals:   make([]int, len(p.Files)),
+				start:    v.Position.Start,
+				values:   make(map[string]*fixedValueStats),
+			}
+			p.positions[key] = ps
+		}
+		vs, ok := ps.values[v.Value]
+		if !ok {
+			vs = &fixedValueStats{Value: v.Value, Valid: v.Valid(), Counts: make([]int, len(p.Files))}
+			ps.values[v.Value] = vs
+		}
+		vs.Counts[i]++
+		ps.Totals[i]++
+	}
+}
+
+// tagOrder sorts the leader before the control fields.
+var tagOrder = map[string]int{"LDR": 0, "006": 1, "007": 2, "008": 3}
+
+// finish sorts the positions by tag, layout and position, and the values of
+// each position.
+func (p *fixedProfile) finish() {
+	for _, ps := range p.positions {
+		for _, vs := range ps.values {
+			ps.Values = append(ps.Values, vs)
+		}
+		sort.Slice(ps.Values, func(i, j int) bool { return ps.Values[i].Value < ps.Values[j].Value })
+		p.Positions = append(p.Positions, ps)
+	}
+	sort.Slice(p.Positions, func(i, j int) bool {
+		a, b := p.Positions[i], p.Positions[j]
+		if a.Tag != b.Tag {
+			return tagOrder[a.Tag] < tagOrder[b.Tag]
+		}
+		if a.Layout != b.Layout {
+			return a.Layout < b.Layout
+		}
+		return a.start < b.start
+	})
+}
+
+// showValue writes blanks as #, as in the MARC 21 documentation.
+func showValue(v string) string {
+	return strings.ReplaceAll(v, " ", "#")
+}
+
+func (p *fixedProfile) writeText(w io.Writer, colors bool) {
+	bold, red, reset := "", "", ""
+	if colors {
+		bold, red, reset = "\x1b[1m", "\x1b[31m", "\x1b[0m"
+	}
+	fmt.Fprint(w, "Number of records:")
+	for i, f := range p.Files {
+		fmt.Fprintf(w, "  %s %d", f, p.Records[i])
+	}
+	fmt.Fprintln(w)
+
+	for _, ps := range p.Positions {
+		label := ps.Tag + "/" + ps.Position
+		if ps.Layout != "" {
+			label = ps.Tag + "/" + ps.Layout + "/" + ps.Position
+		}
+		fmt.Fprintf(w, "\n%s%s%s", bold, label, reset)
+		if ps.Name != "" {
+			fmt.Fprintf(w, " %s", ps.Name)
+		}
+		fmt.Fprintln(w)
+		for _, vs := range ps.Values {
+			fmt.Fprintf(w, "\t%-8s", showValue(vs.Value))
+			for i, n := range vs.Counts {
+				pct := 0.0
+				if ps.Totals[i] > 0 {
+					pct = float64(n) * 100 / float64(ps.Totals[i])
+				}
+				fmt.Fprintf(w, " %8d %5.1f%%", n, pct)
+			}
+			if !vs.Valid {
+				fmt.Fprintf(w, "  %sinvalid%s", red, reset)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func (p *fixedProfile) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"tag", "layout", "position", "name", "value", "valid"}
+	for _, f := range p.Files {
+		header = append(header, f)
+	}
+	cw.Write(header)
+	for _, ps := range p.Positions {
+		for _, vs := range ps.Values {
+			row := []string{ps.Tag, ps.Layout, ps.Position, ps.Name, vs.Value, strconv.FormatBool(vs.Valid)}
+			for _, n := range vs.Counts {
+				row = append(row, strconv.Itoa(n))
+			}
+			cw.Write(row)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/boutros/marc"
+)
+
+// fixedTestFiles returns the records of two files.
+func fixedTestFiles() [][]*marc.Record {
+	rec := func(leader string, cfs ...marc.CField) *marc.Record {
+		r := marc.NewRecord()
+		r.Leader = leader
+		r.CtrlFields = cfs
+		return r
+	}
+	f008 := marc.CField{Tag: "008", Value: "871001s1987    nyu" + strings.Repeat(" ", 17) + "eng d"}
+	return [][]*marc.Record{
+		{
+			rec("00000cam a2200000 a 4500", f008),
+			rec("00000nam a2200000 i 4500", marc.CField{Tag: "007", Value: "cr"}),
+		},
+		{
+			rec("00000cas a2200000 a 4500", f008),
+			rec("00000cax a2200000 a 4500"),
+		},
+	}
+}
+
+func profile(files [][]*marc.Record, reverse bool) *fixedProfile {
+	p := newFixedProfile([]string{"old.mrc", "new.mrc"})
+	for i, records := range files {
+		for j := range records {
+			if reverse {
+				j = len(records) - 1 - j
+			}
+			p.count(i, records[j])
+		}
+	}
+	p.finish()
+	return p
+}
+
+func TestFixedProfile(t *testing.T) {
+	p := profile(fixedTestFiles(), false)
+	if !reflect.DeepEqual(p.Records, []int{2, 2}) {
+		t.Errorf("Records => %v; want [2 2]", p.Records)
+	}
+
+	// The leader comes first, then 007 and 008, each by layout and position.
+	var labels []string
+	for _, ps := range p.Positions {
+		labels = append(labels, ps.Tag+"/"+ps.Layout+"/"+ps.Position)
+	}
+	wantPrefix := []string{
+		"LDR//05", "LDR//06", "LDR//07", "LDR//08", "LDR//09", "LDR//17", "LDR//18", "LDR//19",
+		"007/c/00", "007/c/01",
+		"008/BK/00-05", "008/BK/06", "008/BK/07-10", "008/BK/11-14", "008/BK/15-17", "008/BK/18-21",
+	}
+	if len(labels) < len(wantPrefix) || !reflect.DeepEqual(labels[:len(wantPrefix)], wantPrefix) {
+		t.Errorf("positions =>\n%v\nwant to start with\n%v", labels, wantPrefix)
+	}
+	if i := len(labels) - 1; labels[i] != "008/CR/39" {
+		t.Errorf("last position => %s; want 008/CR/39", labels[i])
+	}
+
+	ps := p.Positions[2] // LDR/07
+	if ps.Name != "Bibliographic level" || !reflect.DeepEqual(ps.Totals, []int{2, 2}) {
+		t.Errorf("LDR/07 => %q, totals %v; want %q, [2 2]", ps.Name, ps.Totals, "Bibliographic level")
+	}
+	var values []fixedValueStats
+	for _, vs := range ps.Values {
+		values = append(values, *vs)
+	}
+	wantValues := []fixedValueStats{
+		{"m", true, []int{2, 0}},
+		{"s", true, []int{0, 1}},
+		{"x", false, []int{0, 1}},
+	}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("LDR/07 values => %v; want %v", values, wantValues)
+	}
+}
+
+func TestFixedProfileWriteCSV(t *testing.T) {
+	p := profile(fixedTestFiles(), false)
+	var b bytes.Buffer
+	if err := p.writeCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(b.String(), "\n")
+	if lines[0] != "tag,layout,position,name,value,valid,old.mrc,new.mrc" {
+		t.Errorf("header => %s", lines[0])
+	}
+	var got []string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "LDR,,07,") || strings.HasPrefix(l, "007,") {
+			got = append(got, l)
+		}
+	}
+	want := []string{
+		"LDR,,07,Bibliographic level,m,true,2,0",
+		"LDR,,07,Bibliographic level,s,true,0,1",
+		"LDR,,07,Bibliographic level,x,false,0,1",
+		"007,c,00,Category of material,c,true,1,0",
+		"007,c,01,Specific material designation,r,true,1,0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writeCSV rows =>\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestFixedProfileStableOutput(t *testing.T) {
+	output := func(p *fixedProfile) string {
+		var b bytes.Buffer
+		p.writeText(&b, false)
+		if err := p.writeCSV(&b); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.NewEncoder(&b).Encode(p); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+	want := output(profile(fixedTestFiles(), false))
+	for i := 0; i < 20; i++ {
+		if got := output(profile(fixedTestFiles(), i%2 == 1)); got != want {
+			t.Fatalf("run %d =>\n%s\nwant\n%s", i, got, want)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -14,184 +18,358 @@ import (
 	"github.com/boutros/marc"
 )
 
-type tagStats map[string]int
+type subFieldStats struct {
+	Code    string  `json:"code"`
+	Count   int     `json:"count"`   // occurrences
+	Records int     `json:"records"` // records containing the subfield
+	Percent float64 `json:"percent"` // of all records
 
-type stats []tagStats
+	lastRecord int // ordinal of last record counted, to count records once
+}
+
+type tagStats struct {
+	Tag          string           `json:"tag"`
+	Count        int              `json:"count"`    // occurrences
+	Records      int              `json:"records"`  // records containing the tag
+	Percent      float64          `json:"percent"`  // of all records
+	Repeated     int              `json:"repeated"` // records with more than one occurrence
+	MaxPerRecord int              `json:"maxPerRecord"`
+	Ind1         map[string]int   `json:"ind1,omitempty"`
+	Ind2         map[string]int   `json:"ind2,omitempty"`
+	SubFields    []*subFieldStats `json:"subfields,omitempty"`
+
+	codes map[string]*subFieldStats
+}
+
+type valueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type specStats struct {
+	Spec     string       `json:"spec"`
+	Distinct int          `json:"distinct"` // number of distinct values
+	Values   []valueCount `json:"values"`   // most frequent first
 
-func newStats() stats {
-	s := make([]tagStats, 1000)
-	for i := 0; i < 1000; i++ {
-		s[i] = make(tagStats)
+	counts map[string]int
+}
+
+type stats struct {
+	Records int          `json:"records"`
+	Tags    []*tagStats  `json:"tags,omitempty"`
+	Specs   []*specStats `json:"specs,omitempty"`
+
+	tags     map[string]*tagStats
+	inRecord map[string]int // occurrences of each tag in current record
+}
+
+func newStats(specs []*marc.MARCSpec) *stats {
+	s := &stats{
+		tags:     make(map[string]*tagStats),
+		inRecord: make(map[string]int),
+	}
+	for _, spec := range specs {
+		s.Specs = append(s.Specs, &specStats{Spec: spec.String(), counts: make(map[string]int)})
 	}
 	return s
 }
 
-func (s stats) countRecord(r *marc.Record) error {
+func (s *stats) tag(tag string) *tagStats {
+	ts, ok := s.tags[tag]
+	if !ok {
+		ts = &tagStats{Tag: tag, codes: make(map[string]*subFieldStats)}
+		s.tags[tag] = ts
+	}
+	return ts
+}
+
+func (s *stats) countRecord(r *marc.Record, specs []*marc.MARCSpec) {
+	s.Records++
+	clear(s.inRecord)
+	for _, cf := range r.CtrlFields {
+		s.tag(cf.Tag).Count++
+		s.inRecord[cf.Tag]++
+	}
 	for _, df := range r.DataFields {
-		i, err := strconv.Atoi(df.Tag)
-		if err != nil {
-			return err
+		ts := s.tag(df.Tag)
+		ts.Count++
+		s.inRecord[df.Tag]++
+		if ts.Ind1 == nil {
+			ts.Ind1, ts.Ind2 = make(map[string]int), make(map[string]int)
 		}
-
+		ts.Ind1[df.Ind1]++
+		ts.Ind2[df.Ind2]++
 		for _, sf := range df.SubFields {
-			s[i][sf.Code] = s[i][sf.Code] + 1
+			ss, ok := ts.codes[sf.Code]
+			if !ok {
+				ss = &subFieldStats{Code: sf.Code, lastRecord: -1}
+				ts.codes[sf.Code] = ss
+			}
+			ss.Count++
+			if ss.lastRecord != s.Records {
+				ss.lastRecord = s.Records
+				ss.Records++
+			}
 		}
 	}
-	return nil
-}
-
-func (s stats) Dump() {
-	var (
-		bold  = "\x1b[1m"
-		reset = "\x1b[0m"
-		//faint = "\x1b[2m"
-	)
-	for i, e := range s {
-		if len(e) == 0 {
-			continue
+	for tag, n := range s.inRecord {
+		ts := s.tags[tag]
+		ts.Records++
+		if n > 1 {
+			ts.Repeated++
 		}
-		fmt.Printf("%03d  ", i)
-		for code, count := range e {
-			fmt.Printf("%s%s%s: %d ", bold, code, reset, count)
+		ts.MaxPerRecord = max(ts.MaxPerRecord, n)
+	}
+
+	// Values selected from the same field are joined.
+	for i, spec := range specs {
+		for _, vals := range spec.FieldValues(r) {
+			s.Specs[i].counts[strings.Join(vals, " > ")]++
 		}
-		fmt.Println()
 	}
 }
 
-func main() {
-	log.SetFlags(0)
-	log.SetPrefix("marcstats: ")
+// finish computes percentages, and sorts everything for output. Value
+// rankings are limited to the top values, unless top is 0.
+func (s *stats) finish(top int) {
+	percent := func(n int) float64 {
+		if s.Records == 0 {
+			return 0
+		}
+		return float64(n) * 100 / float64(s.Records)
+	}
+	for _, ts := range s.tags {
+		ts.Percent = percent(ts.Records)
+		for _, ss := range ts.codes {
+			ss.Percent = percent(ss.Records)
+			ts.SubFields = append(ts.SubFields, ss)
+		}
+		sort.Slice(ts.SubFields, func(i, j int) bool { return ts.SubFields[i].Code < ts.SubFields[j].Code })
+		s.Tags = append(s.Tags, ts)
+	}
+	sort.Slice(s.Tags, func(i, j int) bool { return s.Tags[i].Tag < s.Tags[j].Tag })
 
-	tags := flag.String("t", "", "generate statistics from these tag contents (ex '100e,700a' )")
-	flag.Parse()
+	for _, ss := range s.Specs {
+		ss.Distinct = len(ss.counts)
+		ss.Values = make([]valueCount, 0, len(ss.counts))
+		for v, n := range ss.counts {
+			ss.Values = append(ss.Values, valueCount{v, n})
+		}
+		sort.Slice(ss.Values, func(i, j int) bool {
+			a, b := ss.Values[i], ss.Values[j]
+			return a.Count > b.Count || a.Count == b.Count && a.Value < b.Value
+		})
+		if top > 0 && len(ss.Values) > top {
+			ss.Values = ss.Values[:top]
+		}
+	}
+}
 
-	if len(flag.Args()) < 1 {
-		fmt.Fprintf(os.Stderr, "Usage: marcstats -t<tags> <marcdatabase>\n")
-		os.Exit(1)
+// sortedKeys returns the keys of an indicator distribution, in order.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	f, err := os.Open(flag.Args()[0])
-	if err != nil {
-		log.Fatal(err)
+func (s *stats) writeText(w io.Writer, colors, withTags bool) {
+	bold, reset := "", ""
+	if colors {
+		bold, reset = "\x1b[1m", "\x1b[0m"
 	}
+	fmt.Fprintf(w, "Number of records: %d\n", s.Records)
 
-	// Detect format
-	sniff := make([]byte, 64)
-	_, err = f.Read(sniff)
-	if err != nil {
-		log.Fatal(err)
+	for _, ss := range s.Specs {
+		fmt.Fprintf(w, "\n%s%s%s (%d distinct values)\n", bold, ss.Spec, reset, ss.Distinct)
+		for _, v := range ss.Values {
+			fmt.Fprintf(w, "\t%6d %s\n", v.Count, v.Value)
+		}
 	}
-	format := marc.DetectFormat(sniff)
-	switch format {
-	case marc.MARC, marc.LineMARC, marc.MARCXML:
-		break
-	default:
-		log.Fatal("Unknown MARC format")
+	if !withTags {
+		return
 	}
 
-	// rewind reader
-	_, err = f.Seek(0, 0)
-	if err != nil {
-		log.Fatal(err)
+	inds := func(m map[string]int) string {
+		var b strings.Builder
+		for _, k := range sortedKeys(m) {
+			fmt.Fprintf(&b, " %q:%d", k, m[k])
+		}
+		return b.String()
 	}
-
-	dec := marc.NewDecoder(f, format)
-	c := 0
-	start := time.Now()
-	stats := newStats()
-	var filterTags []string
-	if *tags != "" {
-		filterTags = strings.Split(*tags, ",")
-		for _, t := range filterTags {
-			if len(t) < 4 {
-				log.Fatalf("wrong tag filter format: %q (should be a three-digit number plus one or more subfieldcharacters, ex. \"100e,655ax\")", t)
-			}
+	for _, ts := range s.Tags {
+		fmt.Fprintf(w, "\n%s%s%s  %d records (%.1f%%), %d occurrences, repeated in %d records, max %d per record\n",
+			bold, ts.Tag, reset, ts.Records, ts.Percent, ts.Count, ts.Repeated, ts.MaxPerRecord)
+		if ts.Ind1 != nil {
+			fmt.Fprintf(w, "     ind1%s\n     ind2%s\n", inds(ts.Ind1), inds(ts.Ind2))
+		}
+		for _, ss := range ts.SubFields {
+			fmt.Fprintf(w, "     %s$%s%s  %d records (%.1f%%), %d occurrences\n",
+				bold, ss.Code, reset, ss.Records, ss.Percent, ss.Count)
 		}
 	}
-	filterStats := make(map[string]tagStats)
+}
 
-	for rec, err := dec.Decode(); err != io.EOF; rec, err = dec.Decode() {
-		if err != nil {
-			log.Fatal(err)
-		}
-		if len(filterTags) > 0 {
-			filterCounts(filterTags, filterStats, rec)
-		} else {
-			if err := stats.countRecord(rec); err != nil {
-				log.Println(err)
+func (s *stats) writeCSV(w io.Writer, withTags bool) error {
+	cw := csv.NewWriter(w)
+	f := func(p float64) string { return strconv.FormatFloat(p, 'f', 2, 64) }
+	cw.Write([]string{"type", "tag", "code", "value", "count", "records", "percent", "repeated", "max"})
+	if withTags {
+		for _, ts := range s.Tags {
+			cw.Write([]string{"tag", ts.Tag, "", "", strconv.Itoa(ts.Count), strconv.Itoa(ts.Records), f(ts.Percent),
+				strconv.Itoa(ts.Repeated), strconv.Itoa(ts.MaxPerRecord)})
+			for _, k := range sortedKeys(ts.Ind1) {
+				cw.Write([]string{"ind1", ts.Tag, "", k, strconv.Itoa(ts.Ind1[k]), "", "", "", ""})
+			}
+			for _, k := range sortedKeys(ts.Ind2) {
+				cw.Write([]string{"ind2", ts.Tag, "", k, strconv.Itoa(ts.Ind2[k]), "", "", "", ""})
+			}
+			for _, ss := range ts.SubFields {
+				cw.Write([]string{"subfield", ts.Tag, ss.Code, "", strconv.Itoa(ss.Count), strconv.Itoa(ss.Records), f(ss.Percent), "", ""})
 			}
 		}
-		c++
 	}
-	fmt.Printf("Done in %s\n", time.Now().Sub(start))
-	fmt.Printf("Number of records: %d\n", c)
-	if len(filterTags) > 0 {
-		for tag, e := range filterStats {
-			fmt.Println(tag)
-			ranks := rankByWordCount(e)
-			for _, p := range ranks {
-				fmt.Printf("\t%6d %s\n", p.Value, p.Key)
-			}
-			fmt.Println()
+	for _, ss := range s.Specs {
+		for _, v := range ss.Values {
+			cw.Write([]string{"value", ss.Spec, "", v.Value, strconv.Itoa(v.Count), "", "", "", ""})
 		}
-	} else {
-		stats.Dump()
 	}
+	cw.Flush()
+	return cw.Error()
 }
 
-func filterCounts(filterTags []string, filterStats map[string]tagStats, rec *marc.Record) {
-	for _, df := range rec.DataFields {
-		for _, ft := range filterTags {
-			if df.Tag == ft[0:3] {
-				if len(ft[3:]) == 1 {
-					// one subfield
-					for _, sf := range df.SubFields {
-						if sf.Code == ft[3:] {
-							if _, ok := filterStats[ft]; !ok {
-								filterStats[ft] = make(tagStats)
-							}
-							filterStats[ft][sf.Value] = filterStats[ft][sf.Value] + 1
-						}
-					}
-				} else {
-					// multiple subfields
-					res := []string{}
-					for _, subfieldCode := range ft[3:] {
-						for _, sf := range df.SubFields {
-							if sf.Code == string(subfieldCode) {
-								res = append(res, sf.Value)
-							}
-						}
-						if _, ok := filterStats[ft]; !ok {
-							filterStats[ft] = make(tagStats)
-						}
-						stat := strings.Join(res, " > ")
-						filterStats[ft][stat] = filterStats[ft][stat] + 1
-					}
-				}
-			}
+// shortSpecs rewrites specs in the short form "100e,655ax" (tag and
+// subfield codes) to MARCspecs.
+func shortSpecs(list string) string {
+	specs := strings.Split(list, ",")
+	for i, s := range specs {
+		if len(s) < 4 || strings.ContainsAny(s, "$^/[{") {
+			return list
 		}
+		var b strings.Builder
+		b.WriteString(s[:3])
+		for _, code := range s[3:] {
+			b.WriteString("$" + string(code))
+		}
+		specs[i] = b.String()
 	}
+	return strings.Join(specs, ",")
 }
 
-func rankByWordCount(wordFrequencies map[string]int) PairList {
-	pl := make(PairList, len(wordFrequencies))
-	i := 0
-	for k, v := range wordFrequencies {
-		pl[i] = Pair{k, v}
-		i++
+// scan calls fn with each record in the named file.
+func scan(name string, workers int, fn func(*marc.Record)) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
 	}
-	sort.Sort(sort.Reverse(pl))
-	return pl
-}
+	dec, err := marc.NewAutoDecoder(f)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
 
-type Pair struct {
-	Key   string
-	Value int
+	return marc.Pipeline{Workers: workers}.Run(context.Background(), dec, func(rec *marc.Record, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		fn(rec)
+		return nil
+	})
 }
 
-type PairList []Pair
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("marcstats: ")
+
+	tags := flag.String("t", "", "generate statistics of values selected by these MARCspecs (ex. '100$e,655$a$x{$2=\\lcsh}', or the short form '100e,655ax')")
+	top := flag.Int("top", 0, "only list the N most frequent values of each -t spec (default all)")
+	fixed := flag.Bool("fixed", false, "profile the values at each position of the leader, 006, 007 and 008; given two files, compare them")
+	format := flag.String("format", "text", "output format: text, json or csv")
+	noColor := flag.Bool("no-color", false, "disable colored output")
+	j := flag.Int("j", 1, "number of parallel decoding workers")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: marcstats [options...] <marcdatabase>\n       marcstats -fixed [options...] <marcdatabase> [<marcdatabase>]\n\nOptions:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if n := len(flag.Args()); n < 1 || n > 2 || (n == 2 && !*fixed) {
+		flag.Usage()
+		os.Exit(1)
+	}
+	switch *format {
+	case "text", "json", "csv":
+	default:
+		log.Fatalf("unknown output format: %q", *format)
+	}
+
+	var (
+		specs []*marc.MARCSpec
+		err   error
+	)
+	if *tags != "" {
+		if specs, err = marc.ParseMARCSpecs(shortSpecs(*tags)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	writeJSON := func(v any) error {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	start := time.Now()
 
-func (p PairList) Len() int           { return len(p) }
-func (p PairList) Less(i, j int) bool { return p[i].Value < p[j].Value }
-func (p PairList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+	if *fixed {
+		p := newFixedProfile(flag.Args())
+		for i, name := range flag.Args() {
+			if err := scan(name, *j, func(r *marc.Record) { p.count(i, r) }); err != nil {
+				log.Fatal(err)
+			}
+		}
+		p.finish()
+		if *format == "text" {
+			log.Printf("done in %s", time.Since(start))
+		}
+		switch *format {
+		case "json":
+			err = writeJSON(p)
+		case "csv":
+			err = p.writeCSV(out)
+		default:
+			p.writeText(out, !*noColor)
+		}
+	} else {
+		s := newStats(specs)
+		if err := scan(flag.Arg(0), *j, func(r *marc.Record) { s.countRecord(r, specs) }); err != nil {
+			log.Fatal(err)
+		}
+		s.finish(*top)
+		if *format == "text" {
+			log.Printf("done in %s", time.Since(start))
+		}
+
+		// With -t, only the value statistics are of interest.
+		withTags := len(specs) == 0
+		if !withTags {
+			s.Tags = nil
+		}
+		switch *format {
+		case "json":
+			err = writeJSON(s)
+		case "csv":
+			err = s.writeCSV(out, withTags)
+		default:
+			s.writeText(out, !*noColor, withTags)
+		}
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
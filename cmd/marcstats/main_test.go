@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/boutros/marc"
+)
+
+func statsTestRecords() []*marc.Record {
+	title := func(ind1, a string) marc.DField {
+		f := marc.NewDField("245").AddSubField("a", a)
+		f.Ind1, f.Ind2 = ind1, "0"
+		return f
+	}
+	subject := func(a string) marc.DField {
+		return marc.NewDField("650").AddSubField("a", a)
+	}
+	r1 := marc.NewRecord()
+	r1.CtrlFields = marc.CFields{{Tag: "001", Value: "1"}}
+	r1.DataFields = marc.DFields{
+		title("1", "A").AddSubField("c", "x"),
+		subject("Cats").AddSubField("2", "lcsh"),
+		subject("Dogs"),
+	}
+	r2 := marc.NewRecord()
+	r2.CtrlFields = marc.CFields{{Tag: "001", Value: "2"}}
+	r2.DataFields = marc.DFields{title("0", "B")}
+	r3 := marc.NewRecord()
+	r3.CtrlFields = marc.CFields{{Tag: "001", Value: "3"}}
+	r3.DataFields = marc.DFields{subject("Cats"), subject("Birds"), subject("Ants")}
+	r4 := marc.NewRecord()
+	r4.CtrlFields = marc.CFields{{Tag: "001", Value: "4"}}
+	return []*marc.Record{r1, r2, r3, r4}
+}
+
+func countStats(t *testing.T, records []*marc.Record, spec string, top int) *stats {
+	t.Helper()
+	specs, err := marc.ParseMARCSpecs(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStats(specs)
+	for _, r := range records {
+		s.countRecord(r, specs)
+	}
+	s.finish(top)
+	return s
+}
+
+func TestStatsCounts(t *testing.T) {
+	s := countStats(t, statsTestRecords(), "650$a", 0)
+	if s.Records != 4 {
+		t.Fatalf("Records => %d; want 4", s.Records)
+	}
+	type tagRow struct {
+		Tag                    string
+		Count, Records         int
+		Percent                float64
+		Repeated, MaxPerRecord int
+		Ind1, Ind2             map[string]int
+	}
+	want := []tagRow{
+		{"001", 4, 4, 100, 0, 1, nil, nil},
+		{"245", 2, 2, 50, 0, 1, map[string]int{"0": 1, "1": 1}, map[string]int{"0": 2}},
+		{"650", 5, 2, 50, 2, 3, map[string]int{" ": 5}, map[string]int{" ": 5}},
+	}
+	var got []tagRow
+	for _, ts := range s.Tags {
+		got = append(got, tagRow{ts.Tag, ts.Count, ts.Records, ts.Percent, ts.Repeated, ts.MaxPerRecord, ts.Ind1, ts.Ind2})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags =>\n%+v\nwant\n%+v", got, want)
+	}
+
+	wantSubFields := map[string][]subFieldStats{
+		"245": {{Code: "a", Count: 2, Records: 2, Percent: 50}, {Code: "c", Count: 1, Records: 1, Percent: 25}},
+		"650": {{Code: "2", Count: 1, Records: 1, Percent: 25}, {Code: "a", Count: 5, Records: 2, Percent: 50}},
+	}
+	for _, ts := range s.Tags {
+		var got []subFieldStats
+		for _, ss := range ts.SubFields {
+			got = append(got, subFieldStats{Code: ss.Code, Count: ss.Count, Records: ss.Records, Percent: ss.Percent})
+		}
+		if !reflect.DeepEqual(got, wantSubFields[ts.Tag]) {
+			t.Errorf("%s subfields => %+v; want %+v", ts.Tag, got, wantSubFields[ts.Tag])
+		}
+	}
+
+	wantValues := []valueCount{{"Cats", 2}, {"Ants", 1}, {"Birds", 1}, {"Dogs", 1}}
+	if ss := s.Specs[0]; ss.Distinct != 4 || !reflect.DeepEqual(ss.Values, wantValues) {
+		t.Errorf("650$a => %d distinct, %v; want 4, %v", ss.Distinct, ss.Values, wantValues)
+	}
+}
+
+func TestStatsTop(t *testing.T) {
+	tests := []struct {
+		top  int
+		want []valueCount
+	}{
+		{0, []valueCount{{"Cats", 2}, {"Ants", 1}, {"Birds", 1}, {"Dogs", 1}}},
+		{1, []valueCount{{"Cats", 2}}},
+		{2, []valueCount{{"Cats", 2}, {"Ants", 1}}},
+		{4, []valueCount{{"Cats", 2}, {"Ants", 1}, {"Birds", 1}, {"Dogs", 1}}},
+		{10, []valueCount{{"Cats", 2}, {"Ants", 1}, {"Birds", 1}, {"Dogs", 1}}},
+	}
+	for _, tt := range tests {
+		ss := countStats(t, statsTestRecords(), "650$a", tt.top).Specs[0]
+		if ss.Distinct != 4 || !reflect.DeepEqual(ss.Values, tt.want) {
+			t.Errorf("finish(%d) => %d distinct, %v; want 4, %v", tt.top, ss.Distinct, ss.Values, tt.want)
+		}
+	}
+}
+
+func TestStatsWriteCSV(t *testing.T) {
+	s := countStats(t, statsTestRecords(), "650$a", 0)
+	var b bytes.Buffer
+	if err := s.writeCSV(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	want := `type,tag,code,value,count,records,percent,repeated,max
+tag,001,,,4,4,100.00,0,1
+tag,245,,,2,2,50.00,0,1
+ind1,245,,0,1,,,,
+ind1,245,,1,1,,,,
+ind2,245,,0,2,,,,
+subfield,245,a,,2,2,50.00,,
+subfield,245,c,,1,1,25.00,,
+tag,650,,,5,2,50.00,2,3
+ind1,650,," ",5,,,,
+ind2,650,," ",5,,,,
+subfield,650,2,,1,1,25.00,,
+subfield,650,a,,5,2,50.00,,
+value,650$a,,Cats,2,,,,
+value,650$a,,Ants,1,,,,
+value,650$a,,Birds,1,,,,
+value,650$a,,Dogs,1,,,,
+`
+	if got := b.String(); got != want {
+		t.Errorf("writeCSV =>\n%s\nwant\n%s", got, want)
+	}
+
+	b.Reset()
+	if err := s.writeCSV(&b, false); err != nil {
+		t.Fatal(err)
+	}
+	want = `type,tag,code,value,count,records,percent,repeated,max
+value,650$a,,Cats,2,,,,
+value,650$a,,Ants,1,,,,
+value,650$a,,Birds,1,,,,
+value,650$a,,Dogs,1,,,,
+`
+	if got := b.String(); got != want {
+		t.Errorf("writeCSV without tags =>\n%s\nwant\n%s", got, want)
+	}
+}
+
+// statsOutput returns the text, CSV and JSON output of s.
+func statsOutput(t *testing.T, s *stats) string {
+	t.Helper()
+	var b bytes.Buffer
+	s.writeText(&b, false, true)
+	if err := s.writeCSV(&b, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(&b).Encode(s); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestStatsStableOutput(t *testing.T) {
+	records := statsTestRecords()
+	want := statsOutput(t, countStats(t, records, "650$a,245$a", 0))
+	// Map iteration order changes between runs, and the input order must
+	// not matter either.
+	for i := 0; i < 20; i++ {
+		shuffled := make([]*marc.Record, len(records))
+		for j := range records {
+			shuffled[j] = records[(i+j)%len(records)]
+		}
+		if got := statsOutput(t, countStats(t, shuffled, "650$a,245$a", 0)); got != want {
+			t.Fatalf("run %d =>\n%s\nwant\n%s", i, got, want)
+		}
+	}
+}
+
+func TestShortSpecs(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"100e", "100$e"},
+		{"100e,655ax", "100$e,655$a$x"},
+		{"LDR", "LDR"},
+		{"245", "245"},
+		{"245,650a", "245,650a"},
+		{"100$e", "100$e"},
+		{"100e,655$a", "100e,655$a"},
+		{"008/35-37", "008/35-37"},
+		{"650a{$2=\\lcsh}", "650a{$2=\\lcsh}"},
+		{"245[0]a", "245[0]a"},
+	}
+	for _, tt := range tests {
+		if got := shortSpecs(tt.in); got != tt.want {
+			t.Errorf("shortSpecs(%q) => %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
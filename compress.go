@@ -0,0 +1,142 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression represents a stream compression format wrapping a MARC file.
+type Compression int
+
+// Recognized compression formats
+const (
+	Uncompressed Compression = iota
+	Gzip                     // RFC 1952
+	Bzip2                    // bzip2 (decompression only)
+	Zstd                     // Zstandard (RFC 8878)
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// String returns a string representation of a Compression.
+func (c Compression) String() string {
+	switch c {
+	case Uncompressed:
+		return "uncompressed"
+	case Gzip:
+		return "gzip"
+	case Bzip2:
+		return "bzip2"
+	case Zstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+}
+
+// DetectCompression detects the compression format of the given byte slice
+// by its magic bytes. Data not recognized as compressed is reported as
+// Uncompressed.
+func DetectCompression(data []byte) Compression {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return Zstd
+	case bytes.HasPrefix(data, bzip2Magic):
+		return Bzip2
+	default:
+		return Uncompressed
+	}
+}
+
+// CompressionFromExt returns the compression format implied by the
+// extension of the given file name.
+func CompressionFromExt(name string) Compression {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".gz", ".gzip":
+		return Gzip
+	case ".bz2", ".bzip2":
+		return Bzip2
+	case ".zst", ".zstd":
+		return Zstd
+	default:
+		return Uncompressed
+	}
+}
+
+// NewDecompressor sniffs the magic bytes of the given reader, and returns a
+// reader which decompresses the stream, along with the detected compression.
+// Uncompressed streams are passed through as is. The returned reader must be
+// closed to release resources held by the decompressor.
+func NewDecompressor(r io.Reader) (io.ReadCloser, Compression, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, Uncompressed, err
+	}
+	c := DetectCompression(magic)
+	switch c {
+	case Gzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, c, err
+		}
+		return gr, c, nil
+	case Bzip2:
+		return io.NopCloser(bzip2.NewReader(br)), c, nil
+	case Zstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, c, err
+		}
+		return zr.IOReadCloser(), c, nil
+	default:
+		return io.NopCloser(br), c, nil
+	}
+}
+
+// NewCompressor returns a writer which compresses to w using the given
+// compression format. The returned writer must be closed to flush any
+// pending data; closing it does not close w.
+func NewCompressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case Uncompressed:
+		return nopWriteCloser{w}, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, CheckCompression(c)
+	}
+}
+
+// CheckCompression returns the error NewCompressor gives for c, if writing
+// c is not supported. It lets a command reject an output file name before
+// creating the file.
+func CheckCompression(c Compression) error {
+	switch c {
+	case Uncompressed, Gzip, Zstd:
+		return nil
+	}
+	return fmt.Errorf("writing %s is not supported", c)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,170 @@
+package marc
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"strconv"
+	"testing"
+)
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		input []byte
+		want  Compression
+	}{
+		{[]byte{0x1f, 0x8b, 0x08, 0x00}, Gzip},
+		{[]byte("BZh91AY&SY"), Bzip2},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, Zstd},
+		{[]byte(sampleMARC), Uncompressed},
+		{[]byte(sampleLineMARC), Uncompressed},
+		{[]byte{}, Uncompressed},
+	}
+
+	for _, test := range tests {
+		if c := DetectCompression(test.input); c != test.want {
+			t.Errorf("DetectCompression(%q) => %v; want %v", test.input[:min(4, len(test.input))], c, test.want)
+		}
+	}
+}
+
+func TestCompressionFromExt(t *testing.T) {
+	tests := []struct {
+		name string
+		want Compression
+	}{
+		{"db.mrc.gz", Gzip},
+		{"db.xml.bz2", Bzip2},
+		{"db.zst", Zstd},
+		{"DB.MRC.GZ", Gzip},
+		{"db.mrc", Uncompressed},
+		{"", Uncompressed},
+	}
+
+	for _, test := range tests {
+		if c := CompressionFromExt(test.name); c != test.want {
+			t.Errorf("CompressionFromExt(%q) => %v; want %v", test.name, c, test.want)
+		}
+	}
+}
+
+func TestAutoDecoderCompressed(t *testing.T) {
+	for _, c := range []Compression{Uncompressed, Gzip, Zstd} {
+		for _, test := range []struct {
+			input string
+			f     Format
+		}{
+			{sampleMARC, MARC},
+			{sampleLineMARC, LineMARC},
+			{sampleMARCXML, MARCXML},
+		} {
+			var b bytes.Buffer
+			w, err := NewCompressor(&b, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(test.input)); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dec, err := NewAutoDecoder(&b)
+			if err != nil {
+				t.Fatalf("%v %v: %v", c, test.f, err)
+			}
+			if dec.Format() != test.f || dec.Compression() != c {
+				t.Errorf("NewAutoDecoder => %v, %v; want %v, %v", dec.Format(), dec.Compression(), test.f, c)
+			}
+			recs, err := dec.DecodeAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != 1 {
+				t.Errorf("%v %v: expected 1 record; got %d", c, test.f, len(recs))
+			}
+			if err := dec.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestAutoDecoderUnknownFormat(t *testing.T) {
+	for _, input := range []string{"", "   \n", "abc"} {
+		if _, err := NewAutoDecoder(bytes.NewBufferString(input)); err != ErrUnknownFormat {
+			t.Errorf("NewAutoDecoder(%q) => %v; want %v", input, err, ErrUnknownFormat)
+		}
+	}
+}
+
+func TestNewCompressorBzip2Unsupported(t *testing.T) {
+	if _, err := NewCompressor(&bytes.Buffer{}, Bzip2); err == nil {
+		t.Error("NewCompressor(Bzip2) => nil error; want error")
+	}
+	if err := CheckCompression(Bzip2); err == nil {
+		t.Error("CheckCompression(Bzip2) => nil error; want error")
+	}
+	for _, c := range []Compression{Uncompressed, Gzip, Zstd} {
+		if err := CheckCompression(c); err != nil {
+			t.Errorf("CheckCompression(%v) => %v", c, err)
+		}
+	}
+}
+
+func TestAutoDecoderTruncated(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for _, c := range []Compression{Gzip, Zstd} {
+		for _, f := range []Format{MARC, LineMARC} {
+			// Random titles, for the stream to compress poorly and
+			// be cut halfway through the records.
+			var b bytes.Buffer
+			w, err := NewCompressor(&b, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc := NewEncoder(w, f)
+			for i := 0; i < 2000; i++ {
+				r := NewRecord()
+				r.Leader = "00000cam  2200000 a 4500"
+				r.SetCField(CField{Tag: "001", Value: strconv.Itoa(i)})
+				title := make([]byte, 200)
+				for j := range title {
+					title[j] = 'a' + byte(rnd.IntN(26))
+				}
+				r.AddDField(NewDField("245").AddSubField("a", string(title)))
+				if err := enc.Encode(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			dec, err := NewAutoDecoder(bytes.NewReader(b.Bytes()[:b.Len()/2]))
+			if err != nil {
+				t.Fatalf("%v %v: %v", c, f, err)
+			}
+			var recs, errs int
+			var lastErr error
+			for rec, err := range dec.All() {
+				if err != nil {
+					errs++
+					lastErr = err
+				} else if rec != nil {
+					recs++
+				}
+				if recs+errs > 4000 {
+					t.Fatalf("%v %v: All() does not stop on truncated stream", c, f)
+				}
+			}
+			if recs == 0 || recs >= 2000 || !fatal(lastErr) {
+				t.Errorf("%v %v: All() => %d records, %d errors, last %v; want some records, ending with a read error", c, f, recs, errs, lastErr)
+			}
+			dec.Close()
+		}
+	}
+}
@@ -3,11 +3,13 @@ package marc
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"iter"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -39,17 +41,28 @@ func (f Format) String() string {
 	case MARCXML:
 		return "MarcXchange (ISO25577)"
 	default:
-		panic("unreachable")
+		if e, ok := lookupFormat(f); ok {
+			return e.name
+		}
+		return fmt.Sprintf("Format(%d)", int(f))
 	}
 }
 
 // DetectFormat tries to detect the MARC encoding of the given byte slice. It
-// detects one of LineMARC/MARC/MARCXML, or otherwise unknown.
+// detects one of LineMARC/MARC/MARCXML, or otherwise unknown. The detectors
+// of registered formats are tried first, in order of registration.
 func DetectFormat(data []byte) Format {
+	if f, ok := detectRegistered(data); ok {
+		return f
+	}
+
 	// Find the first non-whitespace byte
 	i := 0
 	for ; i < len(data) && isWS(data[i]); i++ {
 	}
+	if i == len(data) {
+		return unknown
+	}
 	switch data[i] {
 	case '<':
 		return MARCXML
@@ -75,6 +88,12 @@ type Encoder struct {
 	w      *bufio.Writer
 	xmlEnc *xml.Encoder
 	f      Format
+	custom RecordWriter // encoder of registered format
+
+	// scratch buffers for binary MARC, reused between records
+	leader [24]byte
+	head   []byte // directory
+	body   []byte // control fields + data fields
 }
 
 func (enc *Encoder) Encode(r *Record) (err error) {
@@ -133,96 +152,176 @@ func (enc *Encoder) Encode(r *Record) (err error) {
 		writeString(enc.w, "^\n")
 		return err
 	case MARC:
-		const (
-			fs = '' // field separator
-			ss = '' // subfield separator
-			rt = '' // record terminator
-		)
-		var (
-			head bytes.Buffer // leader + directory
-			body bytes.Buffer // control fields + data fields
-			p    = 0          // position in body
-		)
-		for _, f := range r.CtrlFields {
-			start := p
-			p += writeString(&body, f.Value)
-			p += writeByte(&body, fs)
+		return enc.encodeMARC(r)
+	default:
+		if enc.custom == nil {
+			return fmt.Errorf("cannot encode %v: %w", enc.f, ErrUnknownFormat)
+		}
+		return enc.custom.Encode(r)
+	}
+}
 
-			writeString(&head, f.Tag) // TODO make sure Tag is 3 chars
-			writeString(&head, fmt.Sprintf("%04d", len(f.Value)+1))
-			writeString(&head, fmt.Sprintf("%05d", start))
+// encodeMARC encodes r as binary MARC (ISO2709). The record is assembled in
+// the Encoder's scratch buffers, so nothing is written if r is not valid.
+func (enc *Encoder) encodeMARC(r *Record) error {
+	const (
+		fs = '\x1e' // field separator
+		ss = '\x1f' // subfield separator
+		rt = '\x1d' // record terminator
+	)
+	var oneChar = func(s string) byte {
+		if len(s) == 0 {
+			return ' '
 		}
-		for _, f := range r.DataFields {
-			start := p
-			p += writeByte(&body, oneChar(f.Ind1))
-			p += writeByte(&body, oneChar(f.Ind2))
-			p += writeByte(&body, ss)
-			writeString(&head, f.Tag) // TODO make sure Tag is 3 chars
-			for i, sf := range f.SubFields {
-				p += writeString(&body, sf.Code) // TODO make sure Code is 1 char
-				p += writeString(&body, sf.Value)
-				if i < len(f.SubFields)-1 {
-					p += writeByte(&body, ss)
-				}
-			}
-			p += writeByte(&body, fs)
-			writeString(&head, fmt.Sprintf("%04d", p-start))
-			writeString(&head, fmt.Sprintf("%05d", start))
-		}
-		writeByte(&head, fs)
-		writeByte(&body, rt)
-		// We copy the computed size, even if allready present in leader
-		size := 24 + len(head.Bytes()) + len(body.Bytes())
-
-		if size > 99999 {
-			return fmt.Errorf("record is bigger than max supported size in binary MARC (99999): %d", size)
-		}
-		//fmt.Printf("leader: %s computed: %d\n", r.Leader[0:5], size)
-		//fmt.Println(head.String())
-		//fmt.Println(body.String())
-		_, err = enc.w.WriteString(fmt.Sprintf("%05d", size))
-		if err != nil {
-			return err
+		return s[0]
+	}
+
+	head, body := enc.head[:0], enc.body[:0]
+	for _, f := range r.CtrlFields {
+		if len(f.Tag) != 3 {
+			return fmt.Errorf("invalid control field tag %q: must be 3 characters", f.Tag)
 		}
-		_, err = enc.w.WriteString(r.Leader[5:12])
-		if err != nil {
-			return err
+		start := len(body)
+		body = append(body, f.Value...)
+		body = append(body, fs)
+		if len(body)-start > 9999 {
+			return fmt.Errorf("field %s is bigger than max supported size in binary MARC (9999): %d", f.Tag, len(body)-start)
 		}
-		_, err = enc.w.WriteString(fmt.Sprintf("%05d", 24+len(head.Bytes())))
-		if err != nil {
-			return err
+		head = appendDirEntry(head, f.Tag, len(body)-start, start)
+	}
+	for _, f := range r.DataFields {
+		if len(f.Tag) != 3 {
+			return fmt.Errorf("invalid data field tag %q: must be 3 characters", f.Tag)
 		}
-		_, err = enc.w.WriteString(r.Leader[17:])
-		if err != nil {
-			return err
+		start := len(body)
+		body = append(body, oneChar(f.Ind1), oneChar(f.Ind2))
+		for _, sf := range f.SubFields {
+			if len(sf.Code) != 1 {
+				return fmt.Errorf("invalid subfield code %q in field %s: must be 1 byte", sf.Code, f.Tag)
+			}
+			body = append(body, ss)
+			body = append(body, sf.Code...)
+			body = append(body, sf.Value...)
 		}
-		_, err = enc.w.Write(head.Bytes())
-		if err != nil {
-			return err
+		body = append(body, fs)
+		if len(body)-start > 9999 {
+			return fmt.Errorf("field %s is bigger than max supported size in binary MARC (9999): %d", f.Tag, len(body)-start)
 		}
-		_, err = enc.w.Write(body.Bytes())
-		return err
+		head = appendDirEntry(head, f.Tag, len(body)-start, start)
+	}
+	head = append(head, fs)
+	body = append(body, rt)
+	enc.head, enc.body = head, body
+
+	// We copy the computed size, even if allready present in leader
+	size := 24 + len(head) + len(body)
+	if size > 99999 {
+		return fmt.Errorf("record is bigger than max supported size in binary MARC (99999): %d", size)
+	}
+	switch len(r.Leader) {
+	case 0:
+		copy(enc.leader[:], leaderTemplate)
+	case 24:
+		copy(enc.leader[:], r.Leader)
 	default:
-		panic("Encode Unknown")
+		return fmt.Errorf("invalid leader %q: must be 24 characters", r.Leader)
+	}
+	appendDigits(enc.leader[:0], size, 5)
+	appendDigits(enc.leader[:12], 24+len(head), 5)
+
+	if _, err := enc.w.Write(enc.leader[:]); err != nil {
+		return err
+	}
+	if _, err := enc.w.Write(head); err != nil {
+		return err
+	}
+	_, err := enc.w.Write(body)
+	return err
+}
+
+// BinaryLengths returns the record length (leader/00-04) and base address of
+// data (leader/12-16) of r when encoded as binary MARC.
+func (r *Record) BinaryLengths() (length, base int) {
+	base = 24 + 12*(len(r.CtrlFields)+len(r.DataFields)) + 1
+	length = base + 1
+	for _, f := range r.CtrlFields {
+		length += len(f.Value) + 1
+	}
+	for _, f := range r.DataFields {
+		length += 3
+		for _, sf := range f.SubFields {
+			length += 1 + len(sf.Code) + len(sf.Value)
+		}
+	}
+	return length, base
+}
+
+// appendDirEntry appends a binary MARC directory entry to b.
+func appendDirEntry(b []byte, tag string, length, start int) []byte {
+	b = append(b, tag...)
+	b = appendDigits(b, length, 4)
+	return appendDigits(b, start, 5)
+}
+
+// appendDigits appends n to b as a zero-padded decimal number of the given
+// width. n must be non-negative and fit within width digits.
+func appendDigits(b []byte, n, width int) []byte {
+	b = append(b, "00000000"[:width]...)
+	for i := len(b) - 1; i >= len(b)-width; i-- {
+		b[i] = byte('0' + n%10)
+		n /= 10
 	}
+	return b
 }
 
 func (enc *Encoder) Flush() error {
+	if f, ok := enc.custom.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
 	if enc.w == nil {
 		return nil
 	}
 	return enc.w.Flush()
 }
 
+// NewEncoder returns a new Encoder writing to w in the given format. If the
+// format is not known, or cannot be encoded, Encode returns an error.
 func NewEncoder(w io.Writer, f Format) *Encoder {
 	switch f {
 	case MARCXML:
 		return &Encoder{xmlEnc: xml.NewEncoder(w), f: f}
-	default:
+	case MARC, LineMARC:
 		return &Encoder{w: bufio.NewWriter(w), f: f}
+	default:
+		if e, ok := lookupFormat(f); ok && e.newEncoder != nil {
+			return &Encoder{custom: e.newEncoder(w), f: f}
+		}
+		return &Encoder{f: f}
 	}
 }
 
+// ErrUnknownFormat is returned when the MARC format of a stream cannot be detected.
+var ErrUnknownFormat = errors.New("unknown MARC format")
+
+// RecordError is an error in a single malformed record. The framing of the
+// stream is intact, so decoding can go on with the next record. Any other
+// error from Decode, such as an error reading or decompressing the input,
+// ends the stream.
+type RecordError struct {
+	Err error
+}
+
+func (e *RecordError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// fatal reports whether decoding cannot go on after err.
+func fatal(err error) bool {
+	var re *RecordError
+	return err != nil && !errors.As(err, &re)
+}
+
 // Decoder parses MARC records from an input stream.
 type Decoder struct {
 	r      *bufio.Reader
@@ -230,26 +329,99 @@ type Decoder struct {
 	input  []byte
 	pos    int // position in input
 	f      Format
+	c      Compression
+	closer io.Closer       // decompressor, if any
+	custom RecordReader    // decoder of registered format
+	dir    []dirEntry      // binary MARC directory, reused between records
+	tags   map[string]bool // selected tags, or nil for all
 }
 
-// NewDecoder returns a new Decoder using the given reader and format.
+// NewDecoder returns a new Decoder using the given reader and format. If the
+// format is not known, or cannot be decoded, Decode returns ErrUnknownFormat.
+// The caller remains responsible for closing r.
 func NewDecoder(r io.Reader, f Format) *Decoder {
 	switch f {
-	case LineMARC:
+	case LineMARC, MARC:
 		return &Decoder{r: bufio.NewReader(r), f: f}
 	case MARCXML:
 		return &Decoder{xmlDec: xml.NewDecoder(r), f: f}
 	default:
-		return &Decoder{r: bufio.NewReader(r), f: f}
+		if e, ok := lookupFormat(f); ok && e.newDecoder != nil {
+			return &Decoder{custom: e.newDecoder(r), f: f}
+		}
+		return &Decoder{f: f}
+	}
+}
+
+// NewAutoDecoder returns a new Decoder over the given reader, detecting both
+// the MARC format and any compression (gzip, bzip2 or zstd) of the stream.
+// The Decoder should be closed when done, to release the decompressor;
+// closing it does not close r.
+func NewAutoDecoder(r io.Reader) (*Decoder, error) {
+	rc, c, err := NewDecompressor(r)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(rc)
+	sniff, err := br.Peek(64)
+	if err != nil && err != io.EOF {
+		rc.Close()
+		return nil, err
+	}
+	f := DetectFormat(sniff)
+	if f == unknown {
+		rc.Close()
+		return nil, ErrUnknownFormat
+	}
+	d := NewDecoder(br, f)
+	d.c = c
+	d.closer = rc
+	return d, nil
+}
+
+// Format returns the MARC format the Decoder parses.
+func (d *Decoder) Format() Format { return d.f }
+
+// Compression returns the compression of the underlying stream, as detected
+// by NewAutoDecoder.
+func (d *Decoder) Compression() Compression { return d.c }
+
+// Close releases any decompressor used by the Decoder, and closes the
+// decoder of a registered format if it is an io.Closer. It does not close
+// the reader given to NewDecoder or NewAutoDecoder, even if it is an
+// io.ReadCloser; that is left to the caller.
+func (d *Decoder) Close() error {
+	var err error
+	if c, ok := d.custom.(io.Closer); ok {
+		err = c.Close()
+	}
+	if d.closer != nil {
+		if cerr := d.closer.Close(); err == nil {
+			err = cerr
+		}
 	}
+	return err
 }
 
 // DecodeAll consumes the input stream and returns all decoded records.
 // If there is an error, it will return, together with the succesfully
 // parsed MARC records up til then.
 func (d *Decoder) DecodeAll() ([]*Record, error) {
+	return d.DecodeN(0)
+}
+
+// DecodeN is like DecodeAll, but returns at most max records, or all
+// records if max <= 0. When max is reached, the rest of the stream is left
+// unconsumed, so DecodeN can be called repeatedly to process the stream in
+// batches of bounded size. A batch shorter than max signals the end of the
+// stream.
+func (d *Decoder) DecodeN(max int) ([]*Record, error) {
 	res := make([]*Record, 0)
-	for r, err := d.Decode(); err != io.EOF; r, err = d.Decode() {
+	for max <= 0 || len(res) < max {
+		r, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return res, err
 		}
@@ -258,30 +430,129 @@ func (d *Decoder) DecodeAll() ([]*Record, error) {
 	return res, nil
 }
 
+// All returns an iterator over the records in the input stream. Decoding
+// errors are yielded together with a nil record. After a RecordError,
+// iteration proceeds to the next record unless the loop is broken out of;
+// any other error, such as a read error from a truncated stream, is the
+// last element:
+//
+//	for rec, err := range dec.All() {
+//		if err != nil {
+//			log.Println(err)
+//			continue
+//		}
+//		doSomethingWith(rec)
+//	}
+func (d *Decoder) All() iter.Seq2[*Record, error] {
+	return d.Records(context.Background())
+}
+
+// Records is like All, but stops the iteration when ctx is cancelled,
+// yielding the context's error as the final element.
+func (d *Decoder) Records(ctx context.Context) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			r, err := d.Decode()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				r = nil
+			}
+			if !yield(r, err) || fatal(err) {
+				return
+			}
+		}
+	}
+}
+
+// Decode decodes the next record from the input stream.
 func (d *Decoder) Decode() (*Record, error) {
+	r := NewRecord()
+	err := d.DecodeInto(r)
+	return r, err
+}
+
+// DecodeInto decodes the next record from the input stream into r,
+// overwriting its contents. The field and subfield slices of r are reused,
+// and all values of a record share one backing string, so decoding a stream
+// into the same Record keeps allocations to a minimum.
+//
+// Since the slices are recycled, the fields of r must not be retained
+// across calls to DecodeInto; copy out the values you need to keep.
+func (d *Decoder) DecodeInto(r *Record) error {
+	r.reset()
+	var err error
 	switch d.f {
 	case LineMARC:
-		return d.decodeLineMARC()
+		err = d.decodeLineMARC(r)
 	case MARCXML:
-		r := NewRecord()
-		for {
-			t, _ := d.xmlDec.Token()
-			if t == nil {
-				break
-			}
-			switch elem := t.(type) {
-			case xml.StartElement:
-				if elem.Name.Local == "record" {
-					err := d.xmlDec.DecodeElement(r, &elem)
-					return r, err
-				}
+		err = d.decodeMARCXML(r)
+	case MARC:
+		// Binary MARC skips unselected fields while decoding.
+		return d.decodeMARC(r)
+	default:
+		if d.custom == nil {
+			return fmt.Errorf("cannot decode %v: %w", d.f, ErrUnknownFormat)
+		}
+		var rec *Record
+		if rec, err = d.custom.Decode(); rec != nil {
+			*r = *rec
+		}
+	}
+	if d.tags != nil {
+		r.keepTags(d.tags)
+	}
+	return err
+}
+
+// SelectTags restricts decoding to fields with the given tags; all other
+// fields are skipped. For binary MARC the skipped fields are never parsed,
+// which makes extracting a handful of fields from each record much faster.
+// Calling SelectTags without arguments selects all fields again.
+func (d *Decoder) SelectTags(tags ...string) {
+	if len(tags) == 0 {
+		d.tags = nil
+		return
+	}
+	d.tags = make(map[string]bool, len(tags))
+	for _, t := range tags {
+		d.tags[t] = true
+	}
+}
+
+func (d *Decoder) decodeMARCXML(r *Record) error {
+	// encoding/xml unmarshals into the elements past len of a reused
+	// slice, so they must be zeroed to not leak values from last record.
+	clear(r.CtrlFields[:cap(r.CtrlFields)])
+	clear(r.DataFields[:cap(r.DataFields)])
+	for {
+		t, err := d.xmlDec.Token()
+		if err != nil {
+			return err
+		}
+		switch elem := t.(type) {
+		case xml.StartElement:
+			if elem.Name.Local == "record" {
+				return d.xmlDec.DecodeElement(r, &elem)
 			}
 		}
-		return r, io.EOF
-	default:
-		return d.decodeMARC()
 	}
+}
 
+// readAppend reads until and including delim, appending to d.input.
+func (d *Decoder) readAppend(delim byte) error {
+	for {
+		b, err := d.r.ReadSlice(delim)
+		d.input = append(d.input, b...)
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
 }
 
 func (d *Decoder) next() rune {
@@ -333,31 +604,28 @@ func (d *Decoder) nextN(n int) string {
 	return string(d.input[start:d.pos])
 }
 
-func (d *Decoder) decodeLineMARC() (r *Record, err error) {
-	if d.input, err = d.r.ReadBytes(0x5E); err != nil {
-		return r, err
+func (d *Decoder) decodeLineMARC(r *Record) error {
+	d.input = d.input[:0]
+	if err := d.readAppend(0x5E); err != nil {
+		return err
 	}
-	r = NewRecord()
 	// Some records might include the ^ characters, notably in the leader,
-	// so we check to make sure we reached a record terminator
-	// TODO flag the record for replacement of ^ with space in leader and control fields
+	// so we check to make sure we reached a record terminator. The ^ are
+	// placeholders for blanks, and replaced by spaces below.
 	for d.input[len(d.input)-2] != '\n' {
 		// Most likely it's a leader or control field 008 where spaces
 		// are indicated with ^, so we read to the end of the line.
-		b, err := d.r.ReadBytes('\n')
-		if err != nil {
-			return r, err
+		if err := d.readAppend('\n'); err != nil {
+			return err
 		}
-		d.input = append(d.input, b...)
 		// Read to next terminator (hopefully)
-		b, err = d.r.ReadBytes(0x5E)
-		if err != nil {
-			return r, err
+		if err := d.readAppend(0x5E); err != nil {
+			return err
 		}
-		d.input = append(d.input, b...)
 	}
 
 	d.pos = 0
+	arena := string(d.input)
 
 	if d.peek() == '\n' {
 		d.pos++
@@ -370,17 +638,17 @@ func (d *Decoder) decodeLineMARC() (r *Record, err error) {
 		if bytes.HasPrefix(d.input[d.pos:], []byte("00")) {
 			d.pos += 3
 			if len(d.input) < d.pos {
-				return r, nil
+				return nil
 			}
 			// Parse controlfield
 
-			f := CField{Tag: string(d.input[s:d.pos])}
+			f := CField{Tag: internTag(d.input[s:d.pos])}
 			if d.consumeUntil('\n') {
 				if d.input[s+2] == '0' {
 					// controlfield 000 = leader
 					copy(leader, d.input[s+3:d.pos])
 				} else {
-					f.Value = string(d.input[s+3 : d.pos])
+					f.Value = blankPlaceholders(arena[s+3 : d.pos])
 					r.CtrlFields = append(r.CtrlFields, f)
 				}
 				// consume and ignore \n
@@ -394,20 +662,19 @@ func (d *Decoder) decodeLineMARC() (r *Record, err error) {
 		// consume last 3 chars tag + 2 chars indicators
 		d.pos += 5
 		if len(d.input) < d.pos {
-			return r, nil
+			return nil
 		}
 
-		f := DField{
-			Tag:  string(d.input[s : s+3]),
-			Ind1: string(d.input[s+3 : s+4]),
-			Ind2: string(d.input[s+4 : s+5]),
-		}
+		f := r.nextDField()
+		f.Tag = internTag(d.input[s : s+3])
+		f.Ind1 = blankPlaceholders(internByte(d.input[s+3]))
+		f.Ind2 = blankPlaceholders(internByte(d.input[s+4]))
 		// parse subfields
 		for d.next() == '$' {
-			sf := SubField{Code: string(d.next())}
+			sf := SubField{Code: internRune(d.next())}
 			s = d.pos // keep track of subfield start
 			if d.consumeUntilOr('$', '\n') {
-				sf.Value = string(d.input[s:d.pos])
+				sf.Value = arena[s:d.pos]
 				if d.peek() == '\n' {
 					f.SubFields = append(f.SubFields, sf)
 					d.pos++
@@ -416,92 +683,216 @@ func (d *Decoder) decodeLineMARC() (r *Record, err error) {
 			}
 			f.SubFields = append(f.SubFields, sf)
 		}
-		r.DataFields = append(r.DataFields, f)
 	}
 
-	// replace spaces with chars from leader template
+	// replace spaces with chars from leader template, and placeholders
+	// with blanks
 	for i, c := range leader {
-		if c == '\x00' {
+		switch c {
+		case '\x00':
 			leader[i] = leaderTemplate[i]
+		case '^':
+			leader[i] = ' '
 		}
 	}
 	r.Leader = string(leader)
 
-	return r, nil
+	return nil
 }
 
-func (d *Decoder) decodeMARC() (*Record, error) {
-	const recordTerminator = ''
-	r := NewRecord()
+// blankPlaceholders replaces the ^ used for blanks in line-MARC with spaces.
+func blankPlaceholders(s string) string {
+	if strings.IndexByte(s, '^') < 0 {
+		return s
+	}
+	return strings.ReplaceAll(s, "^", " ")
+}
+
+// readMARC reads the next binary MARC record into d.input.
+func (d *Decoder) readMARC() ([]byte, error) {
+	const recordTerminator = '\x1d'
 
-	b, err := d.r.ReadBytes(recordTerminator)
-	if err != nil && len(b) == 0 {
-		return r, err
+	d.input = d.input[:0]
+	err := d.readAppend(recordTerminator)
+	b := d.input
+	if err != nil && (err != io.EOF || len(b) == 0) {
+		return nil, err
 	}
 	if len(b) < 24 {
-		return r, io.EOF
+		return nil, io.EOF
+	}
+	return b, nil
+}
+
+func (d *Decoder) decodeMARC(r *Record) error {
+	b, err := d.readMARC()
+	if err != nil {
+		return err
 	}
+	d.dir, err = d.decodeMARCFrame(b, r, d.dir[:0])
+	return err
+}
+
+// decodeMARCFrame decodes the raw binary MARC record b into r, using dir as
+// scratch space for the directory. It is safe for concurrent use, given
+// distinct records and scratch space.
+func (d *Decoder) decodeMARCFrame(b []byte, r *Record, dir []dirEntry) ([]dirEntry, error) {
+	// All values of the record are sliced from one string.
+	return decodeMARCRecord(b, string(b), r, dir, d.tags)
+}
 
-	r.Leader = string(b[0:24])
-	size, err := strconv.Atoi(r.Leader[0:5])
+// decodeMARCRecord decodes the raw binary MARC record b into r. The values
+// are sliced from data, which must hold the same bytes as b. Only fields
+// with tags in tags are decoded, unless tags is nil.
+func decodeMARCRecord(b []byte, data string, r *Record, dir []dirEntry, tags map[string]bool) ([]dirEntry, error) {
+	dir, err := parseDirectory(b, dir)
 	if err != nil {
-		return r, errors.New("leader pos 0:5 not an integer")
+		return dir, &RecordError{err}
+	}
+
+	r.Leader = data[0:24]
+	for _, e := range dir {
+		if tags != nil && !tags[e.tag] {
+			continue
+		}
+		if e.ctrl {
+			r.CtrlFields = append(r.CtrlFields, CField{Tag: e.tag, Value: data[e.start:e.end]})
+			continue
+		}
+		decodeDField(r.nextDField(), e.tag, data[e.start:e.end])
+	}
+
+	return dir, nil
+}
+
+// dirEntry is a parsed binary MARC directory entry.
+type dirEntry struct {
+	tag        string
+	ctrl       bool // control field
+	start, end int  // field data, excluding field terminator
+}
+
+// parseDirectory validates the leader of the binary MARC record in b, and
+// appends the entries of its directory to dir.
+func parseDirectory(b []byte, dir []dirEntry) ([]dirEntry, error) {
+	if len(b) < 24 {
+		return dir, errors.New("record shorter than leader")
+	}
+	size, ok := atoi(b[0:5])
+	if !ok {
+		return dir, errors.New("leader pos 0:5 not an integer")
 	}
 	if size != len(b) {
-		return r, fmt.Errorf("leader reports size %d; actual size is %d\n", size, len(b))
+		return dir, fmt.Errorf("leader reports size %d; actual size is %d\n", size, len(b))
 	}
 
 	// leader+directory length
-	ll, err := strconv.Atoi(r.Leader[12:17])
-	if err != nil {
-		return r, fmt.Errorf("leader pos 12:17 not an integer: %q", r.Leader[12:17])
+	ll, ok := atoi(b[12:17])
+	if !ok {
+		return dir, fmt.Errorf("leader pos 12:17 not an integer: %q", b[12:17])
 	}
-	p := 24 // position
-	for p < ll-1 {
-		if bytes.HasPrefix(b[p:], []byte("00")) {
-			// control field
-			fl, err := strconv.Atoi(string(b[p+3 : p+7]))
-			if err != nil {
-				return r, errors.New("directory item field length not an integer")
-			}
-			fs, err := strconv.Atoi(string(b[p+7 : p+12]))
-			if err != nil {
-				return r, errors.New("directory item field starting position not an integer")
-			}
-			if ll+fs+fl-1 > size {
-				return r, errors.New("directory item starting position/length out of bounds")
-			}
-			f := CField{Tag: string(b[p : p+3]), Value: string(b[ll+fs : ll+fs+fl-1])}
-			r.CtrlFields = append(r.CtrlFields, f)
-		} else {
-			// data field
-			fl, err := strconv.Atoi(string(b[p+3 : p+7]))
-			if err != nil {
-				return r, errors.New("directory item field length not an integer")
-			}
-			fs, err := strconv.Atoi(string(b[p+7 : p+12]))
-			if err != nil {
-				return r, errors.New("directory item field starting position not an integer")
-			}
-			if ll+fs+fl-1 > size {
-				return r, errors.New("directory item starting position/length out of bounds")
-			}
-			f := DField{
-				Tag:  string(b[p : p+3]),
-				Ind1: string(b[ll+fs : ll+fs+1]),
-				Ind2: string(b[ll+fs+1 : ll+fs+2]),
-			}
-			// parse subfields
-			for _, s := range bytes.Split(b[ll+fs+2:ll+fs+fl-1], []byte("")) {
-				if len(s) > 1 {
-					f.SubFields = append(f.SubFields,
-						SubField{Code: string(s[:1]), Value: string(s[1:])})
-				}
-			}
-			r.DataFields = append(r.DataFields, f)
+	if ll > size {
+		return dir, errors.New("leader base address of data out of bounds")
+	}
+	for p := 24; p < ll-1; p += 12 {
+		if p+12 > ll {
+			return dir, errors.New("directory item truncated")
+		}
+		fl, ok := atoi(b[p+3 : p+7])
+		if !ok {
+			return dir, errors.New("directory item field length not an integer")
+		}
+		fs, ok := atoi(b[p+7 : p+12])
+		if !ok {
+			return dir, errors.New("directory item field starting position not an integer")
+		}
+		e := dirEntry{
+			tag:   internTag(b[p : p+3]),
+			ctrl:  b[p] == '0' && b[p+1] == '0',
+			start: ll + fs,
+			end:   ll + fs + fl - 1,
+		}
+		if fl < 1 || e.end > size {
+			return dir, errors.New("directory item starting position/length out of bounds")
 		}
-		p += 12
+		if !e.ctrl && fl < 3 {
+			return dir, errors.New("directory item field length too short for data field")
+		}
+		dir = append(dir, e)
+	}
+	return dir, nil
+}
+
+// decodeDField decodes the binary MARC data field in data (indicators and
+// subfields, without field terminator) into f.
+func decodeDField(f *DField, tag string, data string) {
+	const subfieldDelimiter = '\x1f'
+
+	f.Tag = tag
+	f.Ind1 = internByte(data[0])
+	f.Ind2 = internByte(data[1])
+	// parse subfields
+	for s := 2; s <= len(data); {
+		e := len(data)
+		if i := strings.IndexByte(data[s:], subfieldDelimiter); i >= 0 {
+			e = s + i
+		}
+		if e-s > 1 {
+			f.SubFields = append(f.SubFields,
+				SubField{Code: internByte(data[s]), Value: data[s+1 : e]})
+		}
+		s = e + 1
+	}
+}
+
+// atoi parses b as a non-negative decimal integer.
+func atoi(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// Tables of interned strings, so that decoding tags, indicators and
+// subfield codes doesn't allocate.
+var (
+	tagTable  [1000]string // "000" - "999"
+	byteTable [256]string  // single byte strings
+)
+
+func init() {
+	for i := range tagTable {
+		tagTable[i] = fmt.Sprintf("%03d", i)
+	}
+	for i := range byteTable {
+		byteTable[i] = string([]byte{byte(i)})
+	}
+}
+
+// internTag returns the tag in b as a string, interned if numeric.
+func internTag(b []byte) string {
+	if n, ok := atoi(b); ok && len(b) == 3 {
+		return tagTable[n]
 	}
+	return string(b)
+}
 
-	return r, nil
+// internByte returns the single byte c as an interned string.
+func internByte(c byte) string {
+	return byteTable[c]
+}
+
+// internRune returns r as a string, interned if ASCII.
+func internRune(r rune) string {
+	if r < utf8.RuneSelf {
+		return byteTable[r]
+	}
+	return string(r)
 }
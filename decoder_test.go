@@ -3,7 +3,12 @@ package marc
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -145,6 +150,252 @@ func testDecodeRecord(t *testing.T, input string, f Format) {
 	}
 }
 
+func TestDecodeN(t *testing.T) {
+	input := strings.Repeat(sampleMARC, 5)
+	dec := NewDecoder(bytes.NewBufferString(input), MARC)
+
+	var sizes []int
+	for {
+		recs, err := dec.DecodeN(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(recs))
+		if len(recs) < 2 {
+			break
+		}
+	}
+	if want := []int{2, 2, 1}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("DecodeN(2) batch sizes => %v; want %v", sizes, want)
+	}
+}
+
+func TestDecoderAll(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		f     Format
+	}{
+		{strings.Repeat(sampleMARC, 3), MARC},
+		{strings.Repeat(sampleLineMARC+"\n", 3), LineMARC},
+	} {
+		dec := NewDecoder(bytes.NewBufferString(test.input), test.f)
+		n := 0
+		for rec, err := range dec.All() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec == nil {
+				t.Fatal("got nil record")
+			}
+			n++
+		}
+		if n != 3 {
+			t.Errorf("%v: All() yielded %d records; want 3", test.f, n)
+		}
+	}
+
+	// Breaking out of the loop leaves the rest of the stream unconsumed.
+	dec := NewDecoder(bytes.NewBufferString(strings.Repeat(sampleMARC, 3)), MARC)
+	for range dec.All() {
+		break
+	}
+	rest, err := dec.DecodeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 2 {
+		t.Errorf("got %d remaining records after break; want 2", len(rest))
+	}
+}
+
+func TestDecoderAllYieldsErrors(t *testing.T) {
+	bad := "00010" + sampleMARC[5:]
+	input := sampleMARC + bad + sampleMARC
+	dec := NewDecoder(bytes.NewBufferString(input), MARC)
+
+	var recs, errs int
+	for rec, err := range dec.All() {
+		if err != nil {
+			if rec != nil {
+				t.Error("got non-nil record together with error")
+			}
+			var re *RecordError
+			if !errors.As(err, &re) {
+				t.Errorf("All() yielded %v; want a RecordError", err)
+			}
+			errs++
+			continue
+		}
+		recs++
+	}
+	if recs != 2 || errs != 1 {
+		t.Errorf("All() => %d records, %d errors; want 2 records, 1 error", recs, errs)
+	}
+}
+
+func TestDecoderRecordsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dec := NewDecoder(bytes.NewBufferString(strings.Repeat(sampleMARC, 3)), MARC)
+
+	var n int
+	var lastErr error
+	for _, err := range dec.Records(ctx) {
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		n++
+		cancel()
+	}
+	if n != 1 || lastErr != context.Canceled {
+		t.Errorf("Records(ctx) => %d records, err %v; want 1 record, err %v", n, lastErr, context.Canceled)
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	other := `*0010010464
+*24510$aAnother title
+^
+`
+	tests := []struct {
+		input string
+		f     Format
+	}{
+		{sampleMARC + sampleMARC, MARC},
+		{sampleLineMARC + "\n" + other, LineMARC},
+		{sampleMARCXML + `<record>
+			<controlfield tag="001"></controlfield>
+			<datafield tag="245" ind1="1" ind2="0"></datafield>
+		</record>`, MARCXML},
+	}
+
+	for _, test := range tests {
+		want, err := NewDecoder(bytes.NewBufferString(test.input), test.f).DecodeAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec := NewDecoder(bytes.NewBufferString(test.input), test.f)
+		r := NewRecord()
+		for i, w := range want {
+			if err := dec.DecodeInto(r); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dumpString(r), dumpString(w)) {
+				t.Errorf("%v: DecodeInto record %d =>\n%s\nwant:\n%s", test.f, i, dumpString(r), dumpString(w))
+			}
+		}
+		if err := dec.DecodeInto(r); err != io.EOF {
+			t.Errorf("%v: DecodeInto at end of stream => %v; want io.EOF", test.f, err)
+		}
+	}
+}
+
+func TestDecodeMARCMalformed(t *testing.T) {
+	tests := []string{
+		"00010" + sampleMARC[5:],                                // size mismatch
+		sampleMARC[:12] + "0x301" + sampleMARC[17:],             // non-numeric base address
+		sampleMARC[:24] + "0010000" + "99999" + sampleMARC[36:], // field start out of bounds
+		sampleMARC[:24] + "0010000" + "00000" + sampleMARC[36:], // zero field length
+		sampleMARC[:12] + "99999" + sampleMARC[17:],             // base address out of bounds
+		sampleMARC[:48] + "010" + "0002" + sampleMARC[55:],      // data field too short
+	}
+
+	for _, input := range tests {
+		dec := NewDecoder(bytes.NewBufferString(input), MARC)
+		if _, err := dec.Decode(); err == nil || err == io.EOF {
+			t.Errorf("Decode(%q...) => %v; want error", input[:60], err)
+		}
+	}
+}
+
+func dumpString(r *Record) string {
+	var b bytes.Buffer
+	r.DumpTo(&b, false)
+	return b.String()
+}
+
+func TestEncodeMARCExact(t *testing.T) {
+	r, err := NewDecoder(bytes.NewBufferString(sampleMARC), MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	enc := NewEncoder(&b, MARC)
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := sampleMARC + sampleMARC; b.String() != want {
+		t.Errorf("Encode MARC =>\n%q\nwant:\n%q", b.String(), want)
+	}
+}
+
+func TestBinaryLengths(t *testing.T) {
+	r, err := NewDecoder(bytes.NewBufferString(sampleMARC), MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	length, base := r.BinaryLengths()
+	if got := fmt.Sprintf("%05d", length); got != r.Leader[0:5] {
+		t.Errorf("record length => %s; want %s", got, r.Leader[0:5])
+	}
+	if got := fmt.Sprintf("%05d", base); got != r.Leader[12:17] {
+		t.Errorf("base address => %s; want %s", got, r.Leader[12:17])
+	}
+}
+
+func TestEncodeMARCInvalid(t *testing.T) {
+	tests := []*Record{
+		{CtrlFields: CFields{{Tag: "01", Value: "x"}}},
+		{DataFields: DFields{{Tag: "2450", SubFields: SubFields{{Code: "a", Value: "x"}}}}},
+		{DataFields: DFields{{Tag: "245", SubFields: SubFields{{Code: "", Value: "x"}}}}},
+		{DataFields: DFields{{Tag: "245", SubFields: SubFields{{Code: "ab", Value: "x"}}}}},
+		{DataFields: DFields{{Tag: "500", SubFields: SubFields{{Code: "a", Value: strings.Repeat("x", 10000)}}}}},
+		{Leader: "00000cam"},
+	}
+
+	for _, r := range tests {
+		var b bytes.Buffer
+		enc := NewEncoder(&b, MARC)
+		if err := enc.Encode(r); err == nil {
+			t.Errorf("Encode(%v) => nil error; want error", r)
+		}
+		enc.Flush()
+		if b.Len() != 0 {
+			t.Errorf("Encode(%v) wrote %d bytes of invalid record", r, b.Len())
+		}
+	}
+}
+
+func TestEncodeMARCEmptyLeader(t *testing.T) {
+	r := NewRecord()
+	r.AddDField(NewDField("245").AddSubField("a", "Title"))
+
+	var b bytes.Buffer
+	enc := NewEncoder(&b, MARC)
+	if err := enc.Encode(r); err != nil {
+		t.Fatal(err)
+	}
+	enc.Flush()
+
+	got, err := NewDecoder(&b, MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "00048c   a2200037   4500"; got.Leader != want {
+		t.Errorf("leader => %q; want %q", got.Leader, want)
+	}
+	if !got.Equal(r, EqualOptions{}) {
+		t.Errorf("got:\n%v\nwant:\n%v", got, r)
+	}
+}
+
 func TestDecodeEncodeRoundtrip(t *testing.T) {
 	tests := []struct{ inF, outF Format }{
 		{MARC, MARC},
@@ -181,7 +432,7 @@ func TestDecodeEncodeRoundtrip(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if !r.Eq(r2) {
+		if !r.Equal(r2, EqualOptions{}) {
 			fmt.Printf("%v\n\n", r)
 			fmt.Printf("%v\n\n", r2)
 			t.Fatalf("decode %s -> encode %s roundtrip failed", test.inF, test.outF)
@@ -212,6 +463,9 @@ func BenchmarkDecodeMARC(b *testing.B)     { benchmarkDecode(b, sampleMARC, MARC
 func BenchmarkDecodeLineMARC(b *testing.B) { benchmarkDecode(b, sampleLineMARC, LineMARC) }
 func BenchmarkDecodeMARCXML(b *testing.B)  { benchmarkDecode(b, sampleMARCXML, MARCXML) }
 
+func BenchmarkDecodeIntoMARC(b *testing.B)     { benchmarkDecodeInto(b, sampleMARC, MARC) }
+func BenchmarkDecodeIntoLineMARC(b *testing.B) { benchmarkDecodeInto(b, sampleLineMARC+"\n", LineMARC) }
+
 func benchmarkDecode(b *testing.B, sample string, f Format) {
 	for n := 0; n < b.N; n++ {
 		b.SetBytes(int64(len(sample)))
@@ -223,6 +477,18 @@ func benchmarkDecode(b *testing.B, sample string, f Format) {
 	}
 }
 
+func benchmarkDecodeInto(b *testing.B, sample string, f Format) {
+	dec := NewDecoder(strings.NewReader(strings.Repeat(sample, b.N)), f)
+	r := NewRecord()
+	b.SetBytes(int64(len(sample)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := dec.DecodeInto(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkEncodeBaseline(b *testing.B) {
 	var w bytes.Buffer
 	for n := 0; n < b.N; n++ {
@@ -254,3 +520,23 @@ func benchmarkEncode(b *testing.B, sample string, f Format) {
 		}
 	}
 }
+
+// BenchmarkEncodeMARCReuse encodes with one Encoder, which reuses its
+// scratch buffers between records.
+func BenchmarkEncodeMARCReuse(b *testing.B) {
+	rec, err := NewDecoder(bytes.NewBufferString(sampleMARC), MARC).Decode()
+	if err != nil {
+		b.Fatal(err)
+	}
+	enc := NewEncoder(io.Discard, MARC)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.SetBytes(int64(len(sampleMARC)))
+		if err := enc.Encode(rec); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,197 @@
+package marc
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// DeltaFunc is called for each record added, changed or deleted between two
+// dumps of a database. The old record is nil for added records, and the
+// current record is nil for deleted records. Returning an error stops the
+// delta.
+type DeltaFunc func(op Op, old, cur *Record) error
+
+// SortedDelta compares the records of two dumps of a database, old and the
+// current one, identified by the key in the given tag (see Record.Key), and
+// calls fn with each record added, changed or deleted. Both dumps must be
+// sorted by key, in byte order, and are read in a single pass.
+//
+// Keys must be unique within each dump: a duplicate key, in either dump, is
+// an error which stops the delta.
+//
+// Records are compared by their Hash, which disregards 005 and the record
+// length and base address of data in the leader.
+func SortedDelta(old, cur RecordReader, keyTag string, fn DeltaFunc) error {
+	o, err := newSortedKeyReader(old, "old", keyTag)
+	if err != nil {
+		return err
+	}
+	n, err := newSortedKeyReader(cur, "new", keyTag)
+	if err != nil {
+		return err
+	}
+
+	for o.rec != nil || n.rec != nil {
+		switch {
+		case n.rec == nil || (o.rec != nil && o.key < n.key):
+			err = fn(Removed, o.rec, nil)
+			if err == nil {
+				err = o.next()
+			}
+		case o.rec == nil || n.key < o.key:
+			err = fn(Added, nil, n.rec)
+			if err == nil {
+				err = n.next()
+			}
+		default:
+			if o.rec.Hash() != n.rec.Hash() {
+				err = fn(Changed, o.rec, n.rec)
+			}
+			if err == nil {
+				err = o.next()
+			}
+			if err == nil {
+				err = n.next()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedKeyReader reads records, checking that they are sorted by key.
+type sortedKeyReader struct {
+	r      RecordReader
+	name   string
+	keyTag string
+	rec    *Record // current record; nil at end
+	key    string  // key of current record
+}
+
+func newSortedKeyReader(r RecordReader, name, keyTag string) (*sortedKeyReader, error) {
+	kr := &sortedKeyReader{r: r, name: name, keyTag: keyTag}
+	return kr, kr.next()
+}
+
+func (kr *sortedKeyReader) next() error {
+	rec, err := kr.r.Decode()
+	if err == io.EOF {
+		kr.rec = nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", kr.name, err)
+	}
+	k := rec.Key(kr.keyTag)
+	if k == "" {
+		return fmt.Errorf("%s: record without key %s", kr.name, kr.keyTag)
+	}
+	if kr.rec != nil && k == kr.key {
+		return fmt.Errorf("%s: duplicate key %s %s", kr.name, kr.keyTag, k)
+	}
+	if kr.rec != nil && k < kr.key {
+		return fmt.Errorf("%s: records not sorted by %s: %q after %q", kr.name, kr.keyTag, k, kr.key)
+	}
+	kr.rec, kr.key = rec, k
+	return nil
+}
+
+// IndexedDelta is like SortedDelta, but the old dump is read through an
+// IndexedReader, so neither dump has to be sorted. The index must be keyed
+// on keyTag. Added and changed records are passed to fn in the order of the
+// current dump, followed by the deleted records in the order of the old dump.
+// As with SortedDelta, a duplicate key in either dump is an error which stops
+// the delta; records of the old dump without a key are left out.
+func IndexedDelta(old *IndexedReader, cur RecordReader, keyTag string, fn DeltaFunc) error {
+	idx := old.Index()
+	if !slices.Contains(idx.KeyTags, keyTag) {
+		return fmt.Errorf("index not keyed on %s", keyTag)
+	}
+	seen := make([]bool, idx.Len())
+	for {
+		rec, err := cur.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("new: %v", err)
+		}
+		k := rec.Key(keyTag)
+		if k == "" {
+			return fmt.Errorf("new: record without key %s", keyTag)
+		}
+		ords := idx.Lookup(keyTag, k)
+		switch {
+		case len(ords) == 0:
+			if err := fn(Added, nil, rec); err != nil {
+				return err
+			}
+			continue
+		case len(ords) > 1:
+			return fmt.Errorf("old: duplicate key %s %s", keyTag, k)
+		}
+		i := ords[0]
+		if seen[i] {
+			return fmt.Errorf("new: duplicate key %s %s", keyTag, k)
+		}
+		seen[i] = true
+		oldRec, err := old.Record(i)
+		if err != nil {
+			return fmt.Errorf("old: %v", err)
+		}
+		if oldRec.Hash() != rec.Hash() {
+			if err := fn(Changed, oldRec, rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, ok := range seen {
+		if ok {
+			continue
+		}
+		oldRec, err := old.Record(i)
+		if err != nil {
+			return fmt.Errorf("old: %v", err)
+		}
+		k := oldRec.Key(keyTag)
+		if k == "" {
+			continue // not identifiable, so cannot be deleted downstream
+		}
+		if len(idx.Lookup(keyTag, k)) > 1 {
+			return fmt.Errorf("old: duplicate key %s %s", keyTag, k)
+		}
+		if err := fn(Removed, oldRec, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteStub returns a stub record announcing the deletion of r: the leader
+// of r with record status (leader/05) 'd', and the control field 001 and key
+// field of r.
+func DeleteStub(r *Record, keyTag string) *Record {
+	leader := []byte(r.Leader)
+	if len(leader) != 24 {
+		leader = []byte(string(leaderTemplate))
+	}
+	leader[5] = 'd'
+
+	stub := NewRecord()
+	stub.Leader = string(leader)
+	if f, ok := r.GetCField("001"); ok {
+		stub.CtrlFields = append(stub.CtrlFields, f)
+	}
+	if keyTag != "001" {
+		if f, ok := r.GetCField(keyTag); ok {
+			stub.CtrlFields = append(stub.CtrlFields, f)
+		} else if fs := r.GetDFields(keyTag); len(fs) > 0 {
+			stub.AddDField(cloneDField(fs[0]))
+		}
+	}
+	return stub
+}
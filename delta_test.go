@@ -0,0 +1,145 @@
+package marc
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func deltaTestRecord(id string, title string, extra ...DField) *Record {
+	r := NewRecord()
+	r.Leader = string(leaderTemplate)
+	r.CtrlFields = CFields{{Tag: "001", Value: id}}
+	r.AddDField(NewDField("245").AddSubField("a", title))
+	r.DataFields = append(r.DataFields, extra...)
+	return r
+}
+
+func recordSlice(recs ...*Record) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		if len(recs) == 0 {
+			return nil, io.EOF
+		}
+		r := recs[0]
+		recs = recs[1:]
+		return r, nil
+	})
+}
+
+func collectDelta(got *[]string) DeltaFunc {
+	return func(op Op, old, cur *Record) error {
+		r := cur
+		if op == Removed {
+			r = old
+		}
+		*got = append(*got, op.String()+" "+r.Key("001"))
+		return nil
+	}
+}
+
+func TestSortedDelta(t *testing.T) {
+	note := NewDField("500").AddSubField("a", "Note")
+	old := []*Record{
+		deltaTestRecord("a", "A"),
+		deltaTestRecord("b", "B"),
+		deltaTestRecord("c", "C"),
+		deltaTestRecord("d", "D", note),
+	}
+	d := deltaTestRecord("d", "D")
+	d.DataFields = DFields{note, d.DataFields[0]}
+	d.Leader = "01234" + d.Leader[5:] // record length disregarded
+	cur := []*Record{
+		deltaTestRecord("a", "A"),
+		deltaTestRecord("b", "B changed"),
+		d,
+		deltaTestRecord("e", "E"),
+	}
+
+	var got []string
+	if err := SortedDelta(recordSlice(old...), recordSlice(cur...), "001", collectDelta(&got)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"changed b", "removed c", "added e"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedDelta => %v; want %v", got, want)
+	}
+
+	// IndexedDelta, with unsorted input
+	var b bytes.Buffer
+	enc := NewEncoder(&b, MARC)
+	for _, r := range []*Record{old[2], old[0], old[3], old[1]} {
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enc.Flush()
+	idx, err := BuildIndex(bytes.NewReader(b.Bytes()), "001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	err = IndexedDelta(NewIndexedReader(bytes.NewReader(b.Bytes()), idx), recordSlice(cur[3], cur[1], cur[0], cur[2]), "001", collectDelta(&got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"added e", "changed b", "removed c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexedDelta => %v; want %v", got, want)
+	}
+
+	// unsorted input
+	err = SortedDelta(recordSlice(old[1], old[0]), recordSlice(), "001", collectDelta(&got))
+	if err == nil {
+		t.Error("SortedDelta with unsorted input => no error")
+	}
+}
+
+func TestDeltaDuplicateKeys(t *testing.T) {
+	a, b, c := deltaTestRecord("a", "A"), deltaTestRecord("b", "B"), deltaTestRecord("c", "C")
+	tests := []struct {
+		name     string
+		old, cur []*Record
+		want     string
+	}{
+		{"duplicate in new", []*Record{a, b}, []*Record{a, b, b}, "new: duplicate key 001 b"},
+		{"duplicate in old", []*Record{a, b, b}, []*Record{a, b}, "old: duplicate key 001 b"},
+		{"deleted duplicate in old", []*Record{a, b, b, c}, []*Record{a, c}, "old: duplicate key 001 b"},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := SortedDelta(recordSlice(tt.old...), recordSlice(tt.cur...), "001", collectDelta(&got))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("SortedDelta, %s => %v; want %s", tt.name, err, tt.want)
+		}
+
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf, MARC)
+		for _, r := range tt.old {
+			if err := enc.Encode(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		enc.Flush()
+		idx, err := BuildIndex(bytes.NewReader(buf.Bytes()), "001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = IndexedDelta(NewIndexedReader(bytes.NewReader(buf.Bytes()), idx), recordSlice(tt.cur...), "001", collectDelta(&got))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("IndexedDelta, %s => %v; want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDeleteStub(t *testing.T) {
+	r := deltaTestRecord("x1", "Title", NewDField("035").AddSubField("a", "(X)1"))
+	got := DeleteStub(r, "035")
+	want := NewRecord()
+	want.Leader = "     d   a22        4500"
+	want.CtrlFields = CFields{{Tag: "001", Value: "x1"}}
+	want.DataFields = DFields{NewDField("035").AddSubField("a", "(X)1")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DeleteStub =>\n%s\nwant:\n%s", dumpString(got), dumpString(want))
+	}
+}
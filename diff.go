@@ -0,0 +1,275 @@
+package marc
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+// Op is the kind of a change between two records.
+type Op int
+
+// Kinds of changes
+const (
+	Added Op = iota + 1
+	Removed
+	Changed
+)
+
+// String returns a string representation of an Op.
+func (op Op) String() string {
+	switch op {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface.
+func (op Op) MarshalText() ([]byte, error) {
+	if op < Added || op > Changed {
+		return nil, fmt.Errorf("unknown change op: %d", op)
+	}
+	return []byte(op.String()), nil
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface.
+func (op *Op) UnmarshalText(b []byte) error {
+	for o := Added; o <= Changed; o++ {
+		if string(b) == o.String() {
+			*op = o
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change op: %q", b)
+}
+
+// FieldChange describes a field which differs between two records.
+type FieldChange struct {
+	Op  Op     `json:"op"`
+	Tag string `json:"tag"` // "LDR" for the leader
+
+	// Control field (or leader) before and after the change. Old is nil
+	// for added fields, and New is nil for removed fields.
+	OldCField *CField `json:"oldCField,omitempty"`
+	NewCField *CField `json:"newCField,omitempty"`
+
+	// Data field before and after the change. Old is nil for added
+	// fields, and New is nil for removed fields.
+	OldDField *DField `json:"oldDField,omitempty"`
+	NewDField *DField `json:"newDField,omitempty"`
+
+	// Changes to the subfields of a changed data field. A data field can
+	// also change only in its indicators.
+	SubFields []SubFieldChange `json:"subFields,omitempty"`
+}
+
+// SubFieldChange describes a subfield which differs between two versions of
+// a data field.
+type SubFieldChange struct {
+	Op   Op     `json:"op"`
+	Code string `json:"code"`
+	Old  string `json:"old,omitempty"` // value before the change
+	New  string `json:"new,omitempty"` // value after the change
+}
+
+// Diff returns the fields which differ from record a to record b, ordered
+// by tag. Like Equal, it disregards the order of fields and subfields, so
+// Diff returns no changes exactly when a.Equal(b, EqualOptions{Leader: true}).
+//
+// Fields are paired up by tag: identical fields first, and the remaining
+// ones in order of appearance, as changed fields. Unpaired fields are added
+// or removed. Subfields of changed data fields are paired up the same way,
+// by code.
+func Diff(a, b *Record) []FieldChange {
+	var res, fields []FieldChange
+	if a.Leader != b.Leader {
+		res = append(res, FieldChange{
+			Op:        Changed,
+			Tag:       "LDR",
+			OldCField: &CField{Tag: "LDR", Value: a.Leader},
+			NewCField: &CField{Tag: "LDR", Value: b.Leader},
+		})
+	}
+
+	for _, tag := range unionTags(a.CtrlFields, b.CtrlFields, func(f CField) string { return f.Tag }) {
+		as, bs := ctrlFieldsByTag(a, tag), ctrlFieldsByTag(b, tag)
+		for _, p := range pairUp(as, bs, func(x, y CField) bool { return x == y }) {
+			c := FieldChange{Op: Changed, Tag: tag}
+			if p[0] >= 0 {
+				c.OldCField = &as[p[0]]
+			} else {
+				c.Op = Added
+			}
+			if p[1] >= 0 {
+				c.NewCField = &bs[p[1]]
+			} else {
+				c.Op = Removed
+			}
+			fields = append(fields, c)
+		}
+	}
+
+	for _, tag := range unionTags(a.DataFields, b.DataFields, func(f DField) string { return f.Tag }) {
+		as, bs := a.GetDFields(tag), b.GetDFields(tag)
+		for _, p := range pairUp(as, bs, equalDField) {
+			c := FieldChange{Op: Changed, Tag: tag}
+			if p[0] >= 0 {
+				c.OldDField = &as[p[0]]
+			} else {
+				c.Op = Added
+			}
+			if p[1] >= 0 {
+				c.NewDField = &bs[p[1]]
+			} else {
+				c.Op = Removed
+			}
+			if c.Op == Changed {
+				c.SubFields = diffSubFields(c.OldDField.SubFields, c.NewDField.SubFields)
+			}
+			fields = append(fields, c)
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Tag < fields[j].Tag })
+	return append(res, fields...)
+}
+
+// DumpChanges writes changes in the style of Record.DumpTo, with removed
+// fields, and changed fields as they were, prefixed by "-", and added fields,
+// and changed fields as they are, prefixed by "+".
+func DumpChanges(w io.Writer, changes []FieldChange, colors bool) {
+	st := newDumpStyle(colors)
+	for _, c := range changes {
+		if c.OldCField != nil {
+			fmt.Fprintf(w, "%s-%s ", st.red, st.reset)
+			st.dumpCField(w, *c.OldCField)
+		}
+		if c.NewCField != nil {
+			fmt.Fprintf(w, "%s+%s ", st.green, st.reset)
+			st.dumpCField(w, *c.NewCField)
+		}
+		if c.OldDField != nil {
+			fmt.Fprintf(w, "%s-%s ", st.red, st.reset)
+			st.dumpDField(w, *c.OldDField, "  ")
+		}
+		if c.NewDField != nil {
+			fmt.Fprintf(w, "%s+%s ", st.green, st.reset)
+			st.dumpDField(w, *c.NewDField, "  ")
+		}
+	}
+}
+
+// diffSubFields returns the changes from subfields a to b, ordered by code.
+func diffSubFields(a, b SubFields) []SubFieldChange {
+	var res []SubFieldChange
+	for _, code := range unionTags(a, b, func(sf SubField) string { return sf.Code }) {
+		as, bs := subFieldsByCode(a, code), subFieldsByCode(b, code)
+		for _, p := range pairUp(as, bs, func(x, y SubField) bool { return x == y }) {
+			c := SubFieldChange{Op: Changed, Code: code}
+			if p[0] >= 0 {
+				c.Old = as[p[0]].Value
+			} else {
+				c.Op = Added
+			}
+			if p[1] >= 0 {
+				c.New = bs[p[1]].Value
+			} else {
+				c.Op = Removed
+			}
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// equalDField tests for data field equality, disregarding subfield order.
+func equalDField(a, b DField) bool {
+	if a.Tag != b.Tag || a.Ind1 != b.Ind1 || a.Ind2 != b.Ind2 || len(a.SubFields) != len(b.SubFields) {
+		return false
+	}
+	as, bs := slices.Clone(a.SubFields), slices.Clone(b.SubFields)
+	sort.Sort(as)
+	sort.Sort(bs)
+	return slices.Equal(as, bs)
+}
+
+// pairUp pairs the elements of as with those of bs. Identical elements are
+// paired first, and left out of the result. The rest are paired in order,
+// with -1 in place of the index of a missing counterpart.
+func pairUp[T any](as, bs []T, eq func(T, T) bool) [][2]int {
+	usedB := make([]bool, len(bs))
+	var restA, restB []int
+	for i, a := range as {
+		found := false
+		for j, b := range bs {
+			if !usedB[j] && eq(a, b) {
+				usedB[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			restA = append(restA, i)
+		}
+	}
+	for j := range bs {
+		if !usedB[j] {
+			restB = append(restB, j)
+		}
+	}
+
+	var res [][2]int
+	for k := 0; k < max(len(restA), len(restB)); k++ {
+		p := [2]int{-1, -1}
+		if k < len(restA) {
+			p[0] = restA[k]
+		}
+		if k < len(restB) {
+			p[1] = restB[k]
+		}
+		res = append(res, p)
+	}
+	return res
+}
+
+// unionTags returns the distinct keys of the elements of a and b, sorted.
+func unionTags[T any](a, b []T, key func(T) string) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, s := range [][]T{a, b} {
+		for _, e := range s {
+			if k := key(e); !seen[k] {
+				seen[k] = true
+				res = append(res, k)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func ctrlFieldsByTag(r *Record, tag string) []CField {
+	var res []CField
+	for _, f := range r.CtrlFields {
+		if f.Tag == tag {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func subFieldsByCode(sfs SubFields, code string) []SubField {
+	var res []SubField
+	for _, sf := range sfs {
+		if sf.Code == code {
+			res = append(res, sf)
+		}
+	}
+	return res
+}
@@ -0,0 +1,85 @@
+package marc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := NewRecord()
+	a.Leader = "00000cam  2200000 a 4500"
+	a.CtrlFields = CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: "20200101"}}
+	a.DataFields = DFields{
+		NewDField("020").AddSubField("a", "111"),
+		NewDField("245").AddSubField("a", "Title").AddSubField("c", "Doe"),
+		NewDField("650").AddSubField("a", "Cats"),
+		NewDField("650").AddSubField("a", "Dogs"),
+	}
+
+	b := NewRecord()
+	b.Leader = "00000nam  2200000 a 4500"
+	b.CtrlFields = CFields{{Tag: "005", Value: "20210101"}, {Tag: "001", Value: "1"}}
+	b.DataFields = DFields{
+		NewDField("650").AddSubField("a", "Dogs"),
+		NewDField("245").AddSubField("c", "Doe").AddSubField("a", "New title").AddSubField("b", "sub"),
+		NewDField("500").AddSubField("a", "Note"),
+	}
+
+	got := Diff(a, b)
+	want := []FieldChange{
+		{Op: Changed, Tag: "LDR", OldCField: &CField{"LDR", a.Leader}, NewCField: &CField{"LDR", b.Leader}},
+		{Op: Changed, Tag: "005", OldCField: &a.CtrlFields[1], NewCField: &b.CtrlFields[0]},
+		{Op: Removed, Tag: "020", OldDField: &a.DataFields[0]},
+		{Op: Changed, Tag: "245", OldDField: &a.DataFields[1], NewDField: &b.DataFields[1],
+			SubFields: []SubFieldChange{
+				{Op: Changed, Code: "a", Old: "Title", New: "New title"},
+				{Op: Added, Code: "b", New: "sub"},
+			}},
+		{Op: Added, Tag: "500", NewDField: &b.DataFields[2]},
+		{Op: Removed, Tag: "650", OldDField: &a.DataFields[2]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff =>")
+		for _, c := range got {
+			t.Errorf("  %+v", c)
+		}
+	}
+
+	if got := Diff(a, a); len(got) != 0 {
+		t.Errorf("Diff(a, a) => %d changes; want none", len(got))
+	}
+
+	c := NewRecord()
+	c.DataFields = DFields{NewDField("245").AddSubField("a", "Title")}
+	d := NewRecord()
+	d.DataFields = DFields{NewDField("245")}
+	d.DataFields[0].Ind1 = "1"
+	d.DataFields[0].SubFields = SubFields{{Code: "a", Value: "Title"}}
+	got = Diff(c, d)
+	if len(got) != 1 || got[0].Op != Changed || len(got[0].SubFields) != 0 {
+		t.Errorf("Diff with changed indicator => %+v; want one change without subfield changes", got)
+	}
+}
+
+func TestDumpChanges(t *testing.T) {
+	a := NewRecord()
+	a.CtrlFields = CFields{{Tag: "001", Value: "1"}}
+	a.DataFields = DFields{NewDField("245").AddSubField("a", "Title")}
+	b := NewRecord()
+	b.DataFields = DFields{
+		NewDField("245").AddSubField("a", "New title"),
+		NewDField("500").AddSubField("a", "Note"),
+	}
+
+	var buf bytes.Buffer
+	DumpChanges(&buf, Diff(a, b), false)
+	want := `- 001 1
+- 245 __ |a Title 
++ 245 __ |a New title 
++ 500 __ |a Note 
+`
+	if got := buf.String(); got != want {
+		t.Errorf("DumpChanges =>\n%s\nwant:\n%s", got, want)
+	}
+}
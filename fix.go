@@ -0,0 +1,232 @@
+package marc
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FixFunc fixes a defect in r in place, and describes each change it makes.
+type FixFunc func(r *Record) (changes []string)
+
+// Fixer is a named, automatic fix of a mechanical record defect.
+type Fixer struct {
+	Name        string
+	Description string
+	Fix         FixFunc
+}
+
+// Fixers returns the catalogue of fixers, in the order they are best
+// applied: placeholders and empty indicators are turned into blanks, spaces
+// are trimmed before empty subfields and fields are removed, then duplicate
+// fields, and the leader lengths are updated last.
+func Fixers() []Fixer {
+	return []Fixer{
+		{"placeholders", `replace "^" placeholders in the leader, control fields and indicators with blanks`, FixPlaceholders},
+		{"indicators", "replace empty indicators with blanks", FixIndicators},
+		{"spaces", "trim leading and trailing spaces in subfields, and collapse repeated spaces", FixSpaces},
+		{"empty", "remove empty subfields, and fields without a value or subfields", FixEmpty},
+		{"duplicates", "remove fields identical to a previous one", FixDuplicates},
+		{"lengths", "set the record length and base address of data in the leader", FixLengths},
+	}
+}
+
+// LookupFixer returns the fixer with the given name from the catalogue.
+func LookupFixer(name string) (Fixer, bool) {
+	for _, f := range Fixers() {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Fixer{}, false
+}
+
+// FixChange is a change made by a fixer.
+type FixChange struct {
+	Fixer   string `json:"fixer"`
+	Message string `json:"message"` // ex. `245[0]$a: "Title " -> "Title"`
+}
+
+// String returns the change as "fixer: message".
+func (c FixChange) String() string {
+	return c.Fixer + ": " + c.Message
+}
+
+// Fix applies the fixers to r in order, or all fixers of the catalogue if
+// none are given, and returns the changes made.
+func Fix(r *Record, fixers ...Fixer) []FixChange {
+	if len(fixers) == 0 {
+		fixers = Fixers()
+	}
+	var changes []FixChange
+	for _, f := range fixers {
+		for _, msg := range f.Fix(r) {
+			changes = append(changes, FixChange{Fixer: f.Name, Message: msg})
+		}
+	}
+	return changes
+}
+
+// FixPlaceholders replaces "^", which some systems use for blanks, with
+// spaces in the leader, control fields and indicators.
+func FixPlaceholders(r *Record) []string {
+	var changes []string
+	if strings.Contains(r.Leader, "^") {
+		v := strings.ReplaceAll(r.Leader, "^", " ")
+		changes = append(changes, fmt.Sprintf("LDR: %q -> %q", r.Leader, v))
+		r.Leader = v
+	}
+	seen := make(tagCounter)
+	for i, f := range r.CtrlFields {
+		n := seen.next(f.Tag)
+		if strings.Contains(f.Value, "^") {
+			v := strings.ReplaceAll(f.Value, "^", " ")
+			changes = append(changes, fmt.Sprintf("%s[%d]: %q -> %q", f.Tag, n, f.Value, v))
+			r.CtrlFields[i].Value = v
+		}
+	}
+	return append(changes, fixIndicators(r, "^")...)
+}
+
+// FixIndicators replaces empty indicators with blanks.
+func FixIndicators(r *Record) []string {
+	return fixIndicators(r, "")
+}
+
+// fixIndicators replaces indicators equal to old with blanks.
+func fixIndicators(r *Record, old string) []string {
+	var changes []string
+	seen := make(tagCounter)
+	for i := range r.DataFields {
+		f := &r.DataFields[i]
+		n := seen.next(f.Tag)
+		if f.Ind1 == old {
+			changes = append(changes, fmt.Sprintf("%s[%d] ind1: %q -> \" \"", f.Tag, n, old))
+			f.Ind1 = " "
+		}
+		if f.Ind2 == old {
+			changes = append(changes, fmt.Sprintf("%s[%d] ind2: %q -> \" \"", f.Tag, n, old))
+			f.Ind2 = " "
+		}
+	}
+	return changes
+}
+
+// FixSpaces trims leading and trailing spaces in subfield values, and
+// collapses repeated spaces into one. Control fields, where spaces are
+// significant, are left as they are.
+func FixSpaces(r *Record) []string {
+	var changes []string
+	seen := make(tagCounter)
+	for i := range r.DataFields {
+		f := &r.DataFields[i]
+		n := seen.next(f.Tag)
+		for j, sf := range f.SubFields {
+			v := strings.Trim(sf.Value, " ")
+			for strings.Contains(v, "  ") {
+				v = strings.ReplaceAll(v, "  ", " ")
+			}
+			if v != sf.Value {
+				changes = append(changes, fmt.Sprintf("%s[%d]$%s: %q -> %q", f.Tag, n, sf.Code, sf.Value, v))
+				f.SubFields[j].Value = v
+			}
+		}
+	}
+	return changes
+}
+
+// FixEmpty removes empty subfields, data fields without subfields, and
+// empty control fields.
+func FixEmpty(r *Record) []string {
+	var changes []string
+	seen := make(tagCounter)
+	r.CtrlFields = slices.DeleteFunc(r.CtrlFields, func(f CField) bool {
+		n := seen.next(f.Tag)
+		if f.Value != "" {
+			return false
+		}
+		changes = append(changes, fmt.Sprintf("removed empty field %s[%d]", f.Tag, n))
+		return true
+	})
+	r.DataFields = slices.DeleteFunc(r.DataFields, func(f DField) bool {
+		n := seen.next(f.Tag)
+		if !slices.ContainsFunc(f.SubFields, func(sf SubField) bool { return sf.Value != "" }) {
+			changes = append(changes, fmt.Sprintf("removed empty field %s[%d]", f.Tag, n))
+			return true
+		}
+		for _, sf := range f.SubFields {
+			if sf.Value == "" {
+				changes = append(changes, fmt.Sprintf("removed empty subfield %s[%d]$%s", f.Tag, n, sf.Code))
+			}
+		}
+		return false
+	})
+	for i := range r.DataFields {
+		f := &r.DataFields[i]
+		f.SubFields = slices.DeleteFunc(f.SubFields, func(sf SubField) bool { return sf.Value == "" })
+	}
+	return changes
+}
+
+// FixDuplicates removes fields identical to a previous field with the same
+// tag, including the order of subfields.
+func FixDuplicates(r *Record) []string {
+	var changes []string
+	seen := make(tagCounter)
+	first := make(map[string]int) // occurrence of the first field with a key
+	dup := func(key, tag string) bool {
+		n := seen.next(tag)
+		if i, ok := first[key]; ok {
+			changes = append(changes, fmt.Sprintf("removed duplicate field %s[%d] (of %s[%d])", tag, n, tag, i))
+			return true
+		}
+		first[key] = n
+		return false
+	}
+	r.CtrlFields = slices.DeleteFunc(r.CtrlFields, func(f CField) bool {
+		return dup(f.Tag+"\x1e"+f.Value, f.Tag)
+	})
+	r.DataFields = slices.DeleteFunc(r.DataFields, func(f DField) bool {
+		var b strings.Builder
+		b.WriteString(f.Tag + "\x1e" + f.Ind1 + "\x1e" + f.Ind2)
+		for _, sf := range f.SubFields {
+			b.WriteString("\x1f" + sf.Code + sf.Value)
+		}
+		return dup(b.String(), f.Tag)
+	})
+	return changes
+}
+
+// FixLengths sets the record length (leader/00-04) and base address of data
+// (leader/12-16) to those of r encoded as binary MARC, if they are set and
+// out of sync. Blank lengths, as in records decoded from line-MARC, are
+// left as they are.
+func FixLengths(r *Record) []string {
+	if len(r.Leader) != 24 {
+		return nil
+	}
+	var changes []string
+	length, base := r.BinaryLengths()
+	set := func(pos string, start, end, n int) {
+		old := r.Leader[start:end]
+		v := fmt.Sprintf("%05d", n)
+		if strings.TrimSpace(old) == "" || old == v || len(v) > 5 {
+			return
+		}
+		changes = append(changes, fmt.Sprintf("LDR/%s: %q -> %q", pos, old, v))
+		r.Leader = r.Leader[:start] + v + r.Leader[end:]
+	}
+	set("00-04", 0, 5, length)
+	set("12-16", 12, 17, base)
+	return changes
+}
+
+// tagCounter counts the occurrences of each tag.
+type tagCounter map[string]int
+
+// next returns the occurrence (counting from 0) of the next field with tag.
+func (c tagCounter) next(tag string) int {
+	n := c[tag]
+	c[tag]++
+	return n
+}
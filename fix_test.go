@@ -0,0 +1,103 @@
+package marc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFix(t *testing.T) {
+	r := NewRecord()
+	r.Leader = "00999cam^^2200049^a^4500"
+	r.CtrlFields = CFields{
+		{Tag: "001", Value: "1"},
+		{Tag: "007", Value: ""},
+		{Tag: "008", Value: "200101s2020^^^^no"},
+	}
+	r.DataFields = DFields{
+		{Tag: "245", Ind1: "1", Ind2: "", SubFields: SubFields{{Code: "a", Value: " The  title "}, {Code: "b", Value: ""}}},
+		{Tag: "500", Ind1: "^", Ind2: " ", SubFields: SubFields{{Code: "a", Value: "  "}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Cats"}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Cats "}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Dogs"}}},
+	}
+
+	var got []string
+	for _, c := range Fix(r) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`placeholders: LDR: "00999cam^^2200049^a^4500" -> "00999cam  2200049 a 4500"`,
+		`placeholders: 008[0]: "200101s2020^^^^no" -> "200101s2020    no"`,
+		`placeholders: 500[0] ind1: "^" -> " "`,
+		`indicators: 245[0] ind2: "" -> " "`,
+		`spaces: 245[0]$a: " The  title " -> "The title"`,
+		`spaces: 500[0]$a: "  " -> ""`,
+		`spaces: 650[1]$a: "Cats " -> "Cats"`,
+		`empty: removed empty field 007[0]`,
+		`empty: removed empty subfield 245[0]$b`,
+		`empty: removed empty field 500[0]`,
+		`duplicates: removed duplicate field 650[1] (of 650[0])`,
+		`lengths: LDR/00-04: "00999" -> "00138"`,
+		`lengths: LDR/12-16: "00049" -> "00085"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Fix =>\n%q\nwant:\n%q", got, want)
+	}
+
+	wantDFields := DFields{
+		{Tag: "245", Ind1: "1", Ind2: " ", SubFields: SubFields{{Code: "a", Value: "The title"}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Cats"}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Dogs"}}},
+	}
+	if !reflect.DeepEqual(r.DataFields, wantDFields) {
+		t.Errorf("Fix => data fields %v; want %v", r.DataFields, wantDFields)
+	}
+	if length, base := r.BinaryLengths(); r.Leader[0:5] != "00138" || length != 138 || base != 85 {
+		t.Errorf("Fix => leader %q; record has length %d and base address %d", r.Leader, length, base)
+	}
+	if changes := Fix(r); len(changes) != 0 {
+		t.Errorf("Fix of fixed record => %v; want no changes", changes)
+	}
+}
+
+func TestFixEmpty(t *testing.T) {
+	r := NewRecord()
+	r.DataFields = DFields{
+		{Tag: "020", Ind1: " ", Ind2: " ", SubFields: SubFields{{Code: "a", Value: ""}, {Code: "q", Value: ""}}},
+		{Tag: "100", Ind1: "1", Ind2: " "},
+		{Tag: "245", Ind1: "1", Ind2: "0", SubFields: SubFields{{Code: "a", Value: ""}, {Code: "b", Value: "T"}, {Code: "c", Value: ""}}},
+	}
+	want := []string{
+		"removed empty field 020[0]",
+		"removed empty field 100[0]",
+		"removed empty subfield 245[0]$a",
+		"removed empty subfield 245[0]$c",
+	}
+	if got := FixEmpty(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("FixEmpty =>\n%q\nwant:\n%q", got, want)
+	}
+	wantDFields := DFields{{Tag: "245", Ind1: "1", Ind2: "0", SubFields: SubFields{{Code: "b", Value: "T"}}}}
+	if !reflect.DeepEqual(r.DataFields, wantDFields) {
+		t.Errorf("FixEmpty => data fields %v; want %v", r.DataFields, wantDFields)
+	}
+}
+
+func TestFixLengthsBlank(t *testing.T) {
+	r := NewRecord()
+	r.Leader = "     cam  22        4500"
+	r.AddDField(NewDField("245").AddSubField("a", "T"))
+	if changes := FixLengths(r); len(changes) != 0 {
+		t.Errorf("FixLengths with blank lengths => %v; want no changes", changes)
+	}
+}
+
+func TestLookupFixer(t *testing.T) {
+	for _, f := range Fixers() {
+		if g, ok := LookupFixer(f.Name); !ok || g.Name != f.Name {
+			t.Errorf("LookupFixer(%q) => %v, %v", f.Name, g.Name, ok)
+		}
+	}
+	if _, ok := LookupFixer("nope"); ok {
+		t.Error("LookupFixer(\"nope\") => true; want false")
+	}
+}
@@ -0,0 +1,316 @@
+package marc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Material is the type of material of a bibliographic record, which
+// determines the layout of 008/18-34 and 006.
+type Material string
+
+// Types of material, as abbreviated in MARC 21.
+const (
+	Books               Material = "BK"
+	ComputerFiles       Material = "CF"
+	Maps                Material = "MP"
+	Music               Material = "MU"
+	ContinuingResources Material = "CR"
+	VisualMaterials     Material = "VM"
+	MixedMaterials      Material = "MX"
+)
+
+// LeaderMaterial returns the type of material given by type of record
+// (leader/06) and bibliographic level (leader/07), or "" if unknown.
+func LeaderMaterial(leader string) Material {
+	if len(leader) < 8 {
+		return ""
+	}
+	if leader[6] == 'a' && strings.IndexByte("bis", leader[7]) >= 0 {
+		return ContinuingResources
+	}
+	return formMaterial(leader[6])
+}
+
+// formMaterial returns the type of material given by type of record, or
+// form of material (006/00), which shares its codes.
+func formMaterial(c byte) Material {
+	switch c {
+	case 'a', 't':
+		return Books
+	case 'm':
+		return ComputerFiles
+	case 'e', 'f':
+		return Maps
+	case 'c', 'd', 'i', 'j':
+		return Music
+	case 's':
+		return ContinuingResources
+	case 'g', 'k', 'o', 'r':
+		return VisualMaterials
+	case 'p':
+		return MixedMaterials
+	}
+	return ""
+}
+
+// Material returns the type of material of r, given by its leader.
+func (r *Record) Material() Material {
+	return LeaderMaterial(r.Leader)
+}
+
+// FixedPosition is a character position, or range of positions, in the
+// leader or a fixed-length control field.
+type FixedPosition struct {
+	Start, End int    // offsets; End is exclusive
+	Name       string // empty if undefined
+	Codes      string // valid characters; empty if any value is valid
+}
+
+// String returns the position in the conventional notation, ex. "06" or
+// "07-10".
+func (p FixedPosition) String() string {
+	if p.End-p.Start <= 1 {
+		return fmt.Sprintf("%02d", p.Start)
+	}
+	return fmt.Sprintf("%02d-%02d", p.Start, p.End-1)
+}
+
+// Valid reports whether v is a valid value of the position: each character
+// must be one of the valid codes.
+func (p FixedPosition) Valid(v string) bool {
+	if p.Codes == "" {
+		return true
+	}
+	for i := 0; i < len(v); i++ {
+		if strings.IndexByte(p.Codes, v[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Code lists, with blank as ' ' and fill character as '|'.
+const (
+	audienceCodes  = " abcdefgj|"
+	formCodes      = " abcdfoqrs|"
+	govPubCodes    = " acfilmosuz|"
+	binaryCodes    = "01|"
+	undefinedCodes = " |"
+	contentsCodes  = " abcdefghijklmnopqrstuvwyz256|"
+)
+
+var leaderPositions = []FixedPosition{
+	{5, 6, "Record status", "acdnp"},
+	{6, 7, "Type of record", "acdefgijkmoprt"},
+	{7, 8, "Bibliographic level", "abcdims"},
+	{8, 9, "Type of control", " a"},
+	{9, 10, "Character coding scheme", " a"},
+	{17, 18, "Encoding level", " 1234578uz"},
+	{18, 19, "Descriptive cataloging form", " acinu"},
+	{19, 20, "Multipart resource record level", " abc"},
+}
+
+// fixed008 are the positions of 008 common to all types of material.
+var fixed008 = []FixedPosition{
+	{0, 6, "Date entered on file", ""},
+	{6, 7, "Type of date/Publication status", "bcdeikmnpqrstu|"},
+	{7, 11, "Date 1", ""},
+	{11, 15, "Date 2", ""},
+	{15, 18, "Place of publication", ""},
+	{35, 38, "Language", ""},
+	{38, 39, "Modified record", " dorsx|"},
+	{39, 40, "Cataloging source", " cdu|"},
+}
+
+// materialPositions are the positions of 008/18-34 for each type of material,
+// as offsets in 008. In 006, they are shifted to 01-17.
+var materialPositions = map[Material][]FixedPosition{
+	Books: {
+		{18, 22, "Illustrations", " abcdefghijklmop|"},
+		{22, 23, "Target audience", audienceCodes},
+		{23, 24, "Form of item", formCodes},
+		{24, 28, "Nature of contents", contentsCodes},
+		{28, 29, "Government publication", govPubCodes},
+		{29, 30, "Conference publication", binaryCodes},
+		{30, 31, "Festschrift", binaryCodes},
+		{31, 32, "Index", binaryCodes},
+		{32, 33, "", undefinedCodes},
+		{33, 34, "Literary form", "01defhijmpsu|"},
+		{34, 35, "Biography", " abcd|"},
+	},
+	ComputerFiles: {
+		{18, 22, "", undefinedCodes},
+		{22, 23, "Target audience", audienceCodes},
+		{23, 24, "Form of item", " oq|"},
+		{24, 26, "", undefinedCodes},
+		{26, 27, "Type of computer file", "abcdefghijmuz|"},
+		{27, 28, "", undefinedCodes},
+		{28, 29, "Government publication", govPubCodes},
+		{29, 35, "", undefinedCodes},
+	},
+	Maps: {
+		{18, 22, "Relief", " abcdefgijkmz|"},
+		{22, 24, "Projection", ""},
+		{24, 25, "", undefinedCodes},
+		{25, 26, "Type of cartographic material", "abcdefguz|"},
+		{26, 28, "", undefinedCodes},
+		{28, 29, "Government publication", govPubCodes},
+		{29, 30, "Form of item", formCodes},
+		{30, 31, "", undefinedCodes},
+		{31, 32, "Index", binaryCodes},
+		{32, 33, "", undefinedCodes},
+		{33, 35, "Special format characteristics", " ejklnoprz|"},
+	},
+	Music: {
+		{18, 20, "Form of composition", ""},
+		{20, 21, "Format of music", "abcdeghiklmnpuz|"},
+		{21, 22, "Music parts", " defnu|"},
+		{22, 23, "Target audience", audienceCodes},
+		{23, 24, "Form of item", formCodes},
+		{24, 30, "Accompanying matter", " abcdefghikrsz|"},
+		{30, 32, "Literary text for sound recordings", " abcdefghijklmnoprstz|"},
+		{32, 33, "", undefinedCodes},
+		{33, 34, "Transposition and arrangement", " abcnu|"},
+		{34, 35, "", undefinedCodes},
+	},
+	ContinuingResources: {
+		{18, 19, "Frequency", " abcdefghijkmqstuwz|"},
+		{19, 20, "Regularity", "nrux|"},
+		{20, 21, "", undefinedCodes},
+		{21, 22, "Type of continuing resource", " dglmnpw|"},
+		{22, 23, "Form of original item", " abcdefoqrs|"},
+		{23, 24, "Form of item", formCodes},
+		{24, 25, "Nature of entire work", contentsCodes},
+		{25, 28, "Nature of contents", contentsCodes},
+		{28, 29, "Government publication", govPubCodes},
+		{29, 30, "Conference publication", binaryCodes},
+		{30, 33, "", undefinedCodes},
+		{33, 34, "Original alphabet or script of title", " abcdefghijkluz|"},
+		{34, 35, "Entry convention", "012|"},
+	},
+	VisualMaterials: {
+		{18, 21, "Running time for motion pictures and videorecordings", ""},
+		{21, 22, "", undefinedCodes},
+		{22, 23, "Target audience", audienceCodes},
+		{23, 28, "", undefinedCodes},
+		{28, 29, "Government publication", govPubCodes},
+		{29, 30, "Form of item", formCodes},
+		{30, 33, "", undefinedCodes},
+		{33, 34, "Type of visual material", "abcdfgiklmnopqrstvwz|"},
+		{34, 35, "Technique", "aclnuz|"},
+	},
+	MixedMaterials: {
+		{18, 23, "", undefinedCodes},
+		{23, 24, "Form of item", formCodes},
+		{24, 35, "", undefinedCodes},
+	},
+}
+
+// smdCodes are the valid specific material designations (007/01) for each
+// category of material (007/00).
+var smdCodes = map[byte]string{
+	'a': "dgjkqrsuyz|",
+	'c': "abcdefhjkmorsuz|",
+	'd': "abceuz|",
+	'f': "abcduz|",
+	'g': "cdfostuz|",
+	'h': "abcdefghjuz|",
+	'k': "acdefghijklnopqrsuvz|",
+	'm': "cforuz|",
+	'o': "u|",
+	'q': "u|",
+	'r': "u|",
+	's': "bdegiqrstuwz|",
+	't': "abcduz|",
+	'v': "cdfruz|",
+	'z': "muz|",
+}
+
+// FixedPositions returns the defined positions of the leader ("LDR") or the
+// fixed-length control field 006, 007 or 008. The layout of 006 and 008
+// depends on the type of material, given as layout, ex. "BK"; the layout of
+// 007 on the category of material (007/00), ex. "c". Only 007/00-01 are
+// defined.
+func FixedPositions(tag, layout string) []FixedPosition {
+	switch tag {
+	case "LDR":
+		return leaderPositions
+	case "008":
+		pos := append([]FixedPosition(nil), fixed008[:5]...)
+		pos = append(pos, materialPositions[Material(layout)]...)
+		return append(pos, fixed008[5:]...)
+	case "006":
+		pos := []FixedPosition{{0, 1, "Form of material", "acdefgijkmoprst"}}
+		for _, p := range materialPositions[Material(layout)] {
+			p.Start, p.End = p.Start-17, p.End-17
+			pos = append(pos, p)
+		}
+		return pos
+	case "007":
+		pos := []FixedPosition{{0, 1, "Category of material", "acdfghkmoqrstvz"}}
+		if len(layout) == 1 {
+			if codes, ok := smdCodes[layout[0]]; ok {
+				pos = append(pos, FixedPosition{1, 2, "Specific material designation", codes})
+			}
+		}
+		return pos
+	}
+	return nil
+}
+
+// FixedValue is the value at a position of the leader or a fixed-length
+// control field of a record.
+type FixedValue struct {
+	Tag      string // LDR, 006, 007 or 008
+	Layout   string // type of material of 006 and 008, category of material of 007
+	Position FixedPosition
+	Value    string
+}
+
+// Valid reports whether the value is valid for its position.
+func (v FixedValue) Valid() bool {
+	return v.Position.Valid(v.Value)
+}
+
+// FixedValues returns the values at each position of the leader and the
+// control fields 006, 007 and 008 of r, in that order. The layout of 008 is
+// given by the leader, and of 006 and 007 by their first character. 007
+// positions beyond the first two are returned one by one, without a name.
+// Positions past the end of a short field are left out.
+func (r *Record) FixedValues() []FixedValue {
+	var res []FixedValue
+	add := func(tag, layout, value string, pos []FixedPosition) {
+		for _, p := range pos {
+			if p.End > len(value) {
+				continue
+			}
+			res = append(res, FixedValue{tag, layout, p, value[p.Start:p.End]})
+		}
+	}
+	add("LDR", "", r.Leader, leaderPositions)
+	for _, tag := range []string{"006", "007", "008"} {
+		for _, f := range r.CtrlFields {
+			if f.Tag != tag || f.Value == "" {
+				continue
+			}
+			var layout string
+			switch tag {
+			case "006":
+				layout = string(formMaterial(f.Value[0]))
+			case "007":
+				layout = f.Value[:1]
+			case "008":
+				layout = string(r.Material())
+			}
+			pos := FixedPositions(tag, layout)
+			if tag == "007" {
+				for i := len(pos); i < len(f.Value); i++ {
+					pos = append(pos, FixedPosition{Start: i, End: i + 1})
+				}
+			}
+			add(tag, layout, f.Value, pos)
+		}
+	}
+	return res
+}
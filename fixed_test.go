@@ -0,0 +1,78 @@
+package marc
+
+import "testing"
+
+func TestLeaderMaterial(t *testing.T) {
+	tests := []struct {
+		leader string
+		want   Material
+	}{
+		{"00100cam  2200049 a 4500", Books},
+		{"00100nas  2200049 a 4500", ContinuingResources},
+		{"00100nai  2200049 a 4500", ContinuingResources},
+		{"00100ntm  2200049 a 4500", Books},
+		{"00100ncm  2200049 a 4500", Music},
+		{"00100nem  2200049 a 4500", Maps},
+		{"00100ngm  2200049 a 4500", VisualMaterials},
+		{"00100nmm  2200049 a 4500", ComputerFiles},
+		{"00100npc  2200049 a 4500", MixedMaterials},
+		{"00100nzm  2200049 a 4500", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := LeaderMaterial(tt.leader); got != tt.want {
+			t.Errorf("LeaderMaterial(%q) => %q; want %q", tt.leader, got, tt.want)
+		}
+	}
+}
+
+func TestFixedPositions(t *testing.T) {
+	for m := range materialPositions {
+		pos := FixedPositions("008", string(m))
+		next := 0
+		for _, p := range pos {
+			if p.Start != next {
+				t.Errorf("008/%s: %s starts at %d; want %d", m, p.Name, p.Start, next)
+			}
+			next = p.End
+		}
+		if next != 40 {
+			t.Errorf("008/%s: positions end at %d; want 40", m, next)
+		}
+
+		pos = FixedPositions("006", string(m))
+		if end := pos[len(pos)-1].End; end != 18 {
+			t.Errorf("006/%s: positions end at %d; want 18", m, end)
+		}
+	}
+}
+
+func TestFixedValues(t *testing.T) {
+	r := NewRecord()
+	r.Leader = "00100xam  2200049 a 4500"
+	r.CtrlFields = CFields{
+		{Tag: "001", Value: "1"},
+		{Tag: "007", Value: "cr |||"},
+		{Tag: "008", Value: "200101s2020    no a   xj     000 1 nob d"}, // 22 and 23 invalid
+	}
+
+	invalid := map[string]string{}
+	for _, v := range r.FixedValues() {
+		if !v.Valid() {
+			invalid[v.Tag+"/"+v.Position.String()] = v.Value
+		}
+	}
+	want := map[string]string{
+		"LDR/05": "x",
+		"008/22": "x",
+		"008/23": "j",
+	}
+	if len(invalid) != len(want) {
+		t.Errorf("invalid values => %v; want %v", invalid, want)
+	}
+	for k, v := range want {
+		if invalid[k] != v {
+			t.Errorf("invalid value at %s => %q; want %q", k, invalid[k], v)
+		}
+	}
+}
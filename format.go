@@ -0,0 +1,115 @@
+package marc
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// formatEntry describes a serialization format known to the package.
+type formatEntry struct {
+	name       string
+	detect     func(data []byte) bool
+	newDecoder func(r io.Reader) RecordReader
+	newEncoder func(w io.Writer) RecordWriter
+}
+
+// formats is indexed by Format. The built-in formats only have names here,
+// since they are handled natively by Decoder, Encoder and DetectFormat.
+var (
+	formatsMu sync.RWMutex
+	formats   = []formatEntry{
+		unknown:  {},
+		MARC:     {name: "marc"},
+		LineMARC: {name: "line-marc"},
+		MARCXML:  {name: "marcxml"},
+	}
+)
+
+// RegisterFormat makes a new serialization format available to NewDecoder,
+// NewEncoder, DetectFormat and NewAutoDecoder, and returns the Format value
+// identifying it.
+//
+// The detector is given the first bytes of a stream (64 bytes when called
+// from NewAutoDecoder), and reports whether they look like the format.
+// Either of detect, newDecoder and newEncoder may be nil, for formats which
+// can't be detected, decoded or encoded, respectively.
+//
+// RegisterFormat is meant to be called from an init function. It panics if
+// a format with the same name (ignoring case) is already registered.
+func RegisterFormat(name string, detect func(data []byte) bool,
+	newDecoder func(r io.Reader) RecordReader, newEncoder func(w io.Writer) RecordWriter) Format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if name == "" {
+		panic("marc: RegisterFormat called with empty name")
+	}
+	for _, e := range formats {
+		if strings.EqualFold(e.name, name) {
+			panic("marc: RegisterFormat called twice for format " + name)
+		}
+	}
+	formats = append(formats, formatEntry{
+		name:       name,
+		detect:     detect,
+		newDecoder: newDecoder,
+		newEncoder: newEncoder,
+	})
+	return Format(len(formats) - 1)
+}
+
+// lookupFormat returns the entry of a registered, non built-in format.
+func lookupFormat(f Format) (formatEntry, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	if f <= MARCXML || int(f) >= len(formats) {
+		return formatEntry{}, false
+	}
+	return formats[f], true
+}
+
+// detectRegistered runs the detectors of the registered formats on data.
+func detectRegistered(data []byte) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for i := MARCXML + 1; int(i) < len(formats); i++ {
+		if d := formats[i].detect; d != nil && d(data) {
+			return i, true
+		}
+	}
+	return unknown, false
+}
+
+// Name returns the short name of a Format, as given to FormatByName:
+// "marc", "line-marc", "marcxml", or the name of a registered format.
+func (f Format) Name() string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	if f <= unknown || int(f) >= len(formats) {
+		return ""
+	}
+	return formats[f].name
+}
+
+// FormatByName returns the Format with the given short name, ignoring case.
+func FormatByName(name string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for i, e := range formats {
+		if i != int(unknown) && strings.EqualFold(e.name, name) {
+			return Format(i), true
+		}
+	}
+	return unknown, false
+}
+
+// Formats returns all known formats, built-in formats first.
+func Formats() []Format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	res := make([]Format, 0, len(formats)-1)
+	for i := MARC; int(i) < len(formats); i++ {
+		res = append(res, i)
+	}
+	return res
+}
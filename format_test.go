@@ -0,0 +1,187 @@
+package marc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// jsonFormat is a toy format with one JSON object per record, registered
+// to test the format registry.
+var jsonFormat = RegisterFormat("test-json",
+	func(data []byte) bool {
+		return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	},
+	func(r io.Reader) RecordReader {
+		dec := json.NewDecoder(r)
+		return ReaderFunc(func() (*Record, error) {
+			rec := NewRecord()
+			if err := dec.Decode(rec); err != nil {
+				return nil, err
+			}
+			return rec, nil
+		})
+	},
+	func(w io.Writer) RecordWriter {
+		enc := json.NewEncoder(w)
+		return WriterFunc(func(r *Record) error { return enc.Encode(r) })
+	},
+)
+
+var detectOnlyFormat = RegisterFormat("test-detect-only",
+	func(data []byte) bool { return bytes.HasPrefix(data, []byte("DETECT")) },
+	nil, nil,
+)
+
+// closingReader records whether it was closed.
+type closingReader struct {
+	RecordReader
+	closed bool
+}
+
+func (r *closingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+var closingFormat = RegisterFormat("test-closing", nil,
+	func(r io.Reader) RecordReader { return &closingReader{RecordReader: NewDecoder(r, MARC)} },
+	nil,
+)
+
+func TestDecoderCloseRegisteredFormat(t *testing.T) {
+	src := &readCloser{Reader: strings.NewReader(sampleMARC)}
+	dec := NewDecoder(src, closingFormat)
+	if err := dec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !dec.custom.(*closingReader).closed {
+		t.Error("Close did not close the decoder of the registered format")
+	}
+	if src.closed {
+		t.Error("Close closed the reader given to NewDecoder")
+	}
+}
+
+// readCloser records whether it was closed.
+type readCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (r *readCloser) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestRegisteredFormatRoundtrip(t *testing.T) {
+	want, err := NewDecoder(strings.NewReader(sampleMARC), MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	enc := NewEncoder(&b, jsonFormat)
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(want); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := NewAutoDecoder(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec.Format() != jsonFormat {
+		t.Fatalf("detected format %v; want %v", dec.Format(), jsonFormat)
+	}
+	recs, err := dec.DecodeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records; want 2", len(recs))
+	}
+	if !recs[1].Equal(want, EqualOptions{Leader: true, FieldOrder: true, SubFieldOrder: true}) {
+		t.Errorf("got:\n%v\nwant:\n%v", recs[1], want)
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want Format
+	}{
+		{"marc", MARC},
+		{"line-marc", LineMARC},
+		{"MARCXML", MARCXML},
+		{"test-json", jsonFormat},
+	}
+	for _, test := range tests {
+		f, ok := FormatByName(test.name)
+		if !ok || f != test.want {
+			t.Errorf("FormatByName(%q) => %v, %v; want %v, true", test.name, f, ok, test.want)
+		}
+		if !strings.EqualFold(f.Name(), test.name) {
+			t.Errorf("%v.Name() => %q; want %q", f, f.Name(), test.name)
+		}
+	}
+	if _, ok := FormatByName(""); ok {
+		t.Error(`FormatByName("") => true; want false`)
+	}
+	if jsonFormat.String() != "test-json" {
+		t.Errorf("String() => %q; want %q", jsonFormat.String(), "test-json")
+	}
+	if s := Format(1000).String(); s != "Format(1000)" {
+		t.Errorf("String() of unknown format => %q; want %q", s, "Format(1000)")
+	}
+
+	all := Formats()
+	if len(all) < 4 || all[0] != MARC || all[1] != LineMARC || all[2] != MARCXML {
+		t.Errorf("Formats() => %v", all)
+	}
+}
+
+func TestRegisterFormatDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering duplicate format name didn't panic")
+		}
+	}()
+	RegisterFormat("MARC", nil, nil, nil)
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	for _, f := range []Format{unknown, detectOnlyFormat, Format(1000)} {
+		if err := NewEncoder(io.Discard, f).Encode(NewRecord()); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Encode %v => %v; want %v", f, err, ErrUnknownFormat)
+		}
+
+		dec := NewDecoder(strings.NewReader(sampleMARC), f)
+		if _, err := dec.Decode(); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Decode %v => %v; want %v", f, err, ErrUnknownFormat)
+		}
+		n := 0
+		for range dec.All() {
+			n++
+		}
+		if n != 1 {
+			t.Errorf("All() on %v yielded %d times; want 1", f, n)
+		}
+		err := Pipeline{}.Run(context.Background(), dec, func(r *Record, err error) error { return nil })
+		if !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Pipeline on %v => %v; want %v", f, err, ErrUnknownFormat)
+		}
+	}
+
+	if f := DetectFormat([]byte("DETECT me")); f != detectOnlyFormat {
+		t.Errorf("DetectFormat => %v; want %v", f, detectOnlyFormat)
+	}
+}
@@ -0,0 +1,112 @@
+package marc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"sort"
+)
+
+// CanonicalOptions control which parts of a record are included in its
+// canonical serialization, and thereby in its hash.
+type CanonicalOptions struct {
+	// IgnoreTags are volatile fields left out, ex. "005" (date and time
+	// of latest transaction).
+	IgnoreTags []string
+
+	// IgnoreLeaderLengths blanks out the record length (leader/00-04) and
+	// base address of data (leader/12-16), which depend on the
+	// serialization rather than the content of the record.
+	IgnoreLeaderLengths bool
+}
+
+// DefaultCanonicalOptions returns the options used by Hash and Fingerprint:
+// 005 and the leader lengths are left out.
+func DefaultCanonicalOptions() CanonicalOptions {
+	return CanonicalOptions{
+		IgnoreTags:          []string{"005"},
+		IgnoreLeaderLengths: true,
+	}
+}
+
+// AppendCanonical appends the canonical serialization of r to b, and returns
+// the extended buffer. The same record decoded from any format has the same
+// canonical serialization. It is laid out like binary MARC without the
+// directory:
+//
+//	leader                 24 bytes; with IgnoreLeaderLengths, positions
+//	                       0-4 and 12-16 are zeros
+//	control fields         tag, value, field terminator (0x1E)
+//	data fields            tag, ind1, ind2, then for each subfield the
+//	                       delimiter (0x1F), code and value; and the
+//	                       field terminator (0x1E)
+//	record terminator      0x1D
+//
+// Control fields come before data fields, and fields are ordered by tag,
+// keeping the order of fields with the same tag. Subfields keep their order.
+// Empty indicators are written as blanks.
+func (r *Record) AppendCanonical(b []byte, opts CanonicalOptions) []byte {
+	if opts.IgnoreLeaderLengths && len(r.Leader) == 24 {
+		b = append(b, "00000"...)
+		b = append(b, r.Leader[5:12]...)
+		b = append(b, "00000"...)
+		b = append(b, r.Leader[17:]...)
+	} else {
+		b = append(b, r.Leader...)
+	}
+
+	ctrl := slices.Clone(r.CtrlFields)
+	sort.SliceStable(ctrl, func(i, j int) bool { return ctrl[i].Tag < ctrl[j].Tag })
+	for _, f := range ctrl {
+		if slices.Contains(opts.IgnoreTags, f.Tag) {
+			continue
+		}
+		b = append(b, f.Tag...)
+		b = append(b, f.Value...)
+		b = append(b, '\x1e')
+	}
+
+	data := slices.Clone(r.DataFields)
+	sort.SliceStable(data, func(i, j int) bool { return data[i].Tag < data[j].Tag })
+	for _, f := range data {
+		if slices.Contains(opts.IgnoreTags, f.Tag) {
+			continue
+		}
+		b = append(b, f.Tag...)
+		b = appendIndicator(b, f.Ind1)
+		b = appendIndicator(b, f.Ind2)
+		for _, sf := range f.SubFields {
+			b = append(b, '\x1f')
+			b = append(b, sf.Code...)
+			b = append(b, sf.Value...)
+		}
+		b = append(b, '\x1e')
+	}
+	return append(b, '\x1d')
+}
+
+func appendIndicator(b []byte, ind string) []byte {
+	if ind == "" {
+		return append(b, ' ')
+	}
+	return append(b, ind...)
+}
+
+// HashWith returns the SHA-256 hash of the canonical serialization of r,
+// using the given options.
+func (r *Record) HashWith(opts CanonicalOptions) [sha256.Size]byte {
+	return sha256.Sum256(r.AppendCanonical(nil, opts))
+}
+
+// Hash returns the SHA-256 hash of the canonical serialization of r, using
+// DefaultCanonicalOptions. Records with the same content have the same hash,
+// regardless of the format they were decoded from.
+func (r *Record) Hash() [sha256.Size]byte {
+	return r.HashWith(DefaultCanonicalOptions())
+}
+
+// Fingerprint returns Hash as a hexadecimal string.
+func (r *Record) Fingerprint() string {
+	h := r.Hash()
+	return hex.EncodeToString(h[:])
+}
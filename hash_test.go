@@ -0,0 +1,148 @@
+package marc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHashAcrossFormats(t *testing.T) {
+	r, err := NewDecoder(bytes.NewBufferString(sampleMARC), MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// LineMARC cannot represent the subfield delimiter in values.
+	for i := range r.DataFields {
+		for j, sf := range r.DataFields[i].SubFields {
+			r.DataFields[i].SubFields[j].Value = strings.ReplaceAll(sf.Value, "$", "")
+		}
+	}
+	want := r.Fingerprint()
+
+	for _, f := range []Format{MARC, LineMARC, MARCXML} {
+		var b bytes.Buffer
+		enc := NewEncoder(&b, f)
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewDecoder(&b, f).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fp := got.Fingerprint(); fp != want {
+			t.Errorf("Fingerprint of record from %v => %s; want %s", f, fp, want)
+		}
+	}
+}
+
+func TestHashLineMARCPlaceholders(t *testing.T) {
+	// Line-MARC as exported by NORMARC systems, with ^ for blanks.
+	lm := "*000^^^^^cam^^2200000^a^4500\n" +
+		"*0011234\n" +
+		"*008871001s1987^^^^no^^^^^^^^^^^^000^0^nob^^\n" +
+		"*100^0$aDoe, Jane\n" +
+		"*24510$aTitle$bsubtitle\n^\n"
+	fromLM, err := NewDecoder(strings.NewReader(lm), LineMARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRecord()
+	r.Leader = "00000cam  2200000 a 4500"
+	r.CtrlFields = CFields{
+		{Tag: "001", Value: "1234"},
+		{Tag: "008", Value: "871001s1987    no            000 0 nob  "},
+	}
+	r.DataFields = DFields{
+		{Tag: "100", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Doe, Jane"}}},
+		{Tag: "245", Ind1: "1", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Title"}, {Code: "b", Value: "subtitle"}}},
+	}
+	want := r.Fingerprint()
+	if fp := fromLM.Fingerprint(); fp != want {
+		t.Errorf("Fingerprint of line-MARC record with ^ placeholders => %s; want %s\n%q", fp, want, fromLM.AppendCanonical(nil, DefaultCanonicalOptions()))
+	}
+
+	for _, f := range []Format{MARC, MARCXML} {
+		var b bytes.Buffer
+		enc := NewEncoder(&b, f)
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewDecoder(&b, f).Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fp := got.Fingerprint(); fp != want {
+			t.Errorf("Fingerprint of record from %v => %s; want %s", f, fp, want)
+		}
+	}
+}
+
+func TestHashOptions(t *testing.T) {
+	newRec := func(leader, f005, title string) *Record {
+		r := NewRecord()
+		r.Leader = leader
+		r.CtrlFields = CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: f005}}
+		r.DataFields = DFields{
+			NewDField("245").AddSubField("a", title),
+			NewDField("999").AddSubField("a", title),
+		}
+		return r
+	}
+	a := newRec("00100cam  2200049 a 4500", "20200101", "Title")
+
+	tests := []struct {
+		b    *Record
+		opts CanonicalOptions
+		want bool
+	}{
+		{newRec("00100cam  2200049 a 4500", "20200101", "Title"), CanonicalOptions{}, true},
+		{newRec("00100cam  2200049 a 4500", "20210101", "Title"), CanonicalOptions{}, false},
+		{newRec("00100cam  2200049 a 4500", "20210101", "Title"), DefaultCanonicalOptions(), true},
+		{newRec("00200cam  2200099 a 4500", "20200101", "Title"), CanonicalOptions{}, false},
+		{newRec("00200cam  2200099 a 4500", "20200101", "Title"), DefaultCanonicalOptions(), true},
+		{newRec("00100nam  2200049 a 4500", "20200101", "Title"), DefaultCanonicalOptions(), false},
+		{newRec("00100cam  2200049 a 4500", "20200101", "Other"), DefaultCanonicalOptions(), false},
+		{newRec("00100cam  2200049 a 4500", "20210101", "Title"), CanonicalOptions{IgnoreTags: []string{"005", "999"}}, true},
+	}
+	for i, test := range tests {
+		if got := a.HashWith(test.opts) == test.b.HashWith(test.opts); got != test.want {
+			t.Errorf("%d: equal hashes with %+v => %v; want %v", i, test.opts, got, test.want)
+		}
+	}
+
+	// Fields with different tags can be reordered, but not fields of the same tag.
+	b := newRec("00100cam  2200049 a 4500", "20200101", "Title")
+	b.CtrlFields[0], b.CtrlFields[1] = b.CtrlFields[1], b.CtrlFields[0]
+	b.DataFields[0], b.DataFields[1] = b.DataFields[1], b.DataFields[0]
+	if a.Hash() != b.Hash() {
+		t.Error("Hash differs with fields in different order")
+	}
+	c := newRec("00100cam  2200049 a 4500", "20200101", "Title")
+	c.DataFields[1].Tag = "245"
+	c.DataFields[1].SubFields[0].Value = "Other"
+	d := newRec("00100cam  2200049 a 4500", "20200101", "Other")
+	d.DataFields[1].Tag = "245"
+	d.DataFields[1].SubFields[0].Value = "Title"
+	if c.Hash() == d.Hash() {
+		t.Error("Hash equal with repeated fields in different order")
+	}
+}
+
+func TestAppendCanonical(t *testing.T) {
+	r := NewRecord()
+	r.Leader = "01234cam  2201234 a 4500"
+	r.CtrlFields = CFields{{Tag: "008", Value: "x"}, {Tag: "001", Value: "1"}}
+	r.DataFields = DFields{{Tag: "245", Ind1: "1", SubFields: SubFields{{"a", "T"}, {"c", "D"}}}}
+	got := string(r.AppendCanonical(nil, DefaultCanonicalOptions()))
+	want := "00000cam  2200000 a 45000011\x1e008x\x1e2451 \x1faT\x1fcD\x1e\x1d"
+	if got != want {
+		t.Errorf("AppendCanonical => %q; want %q", got, want)
+	}
+}
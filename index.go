@@ -0,0 +1,195 @@
+package marc
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultIndexKeys are the tags used as lookup keys by an Index, unless
+// others are given. For data fields, the values of subfield $a are used.
+var DefaultIndexKeys = []string{"001", "035", "020"}
+
+// Index holds the offsets of the records in a binary MARC file, so that
+// single records can be fetched without decoding the file from the start.
+// It can optionally map key values, such as the record identifier in 001,
+// to the ordinals of the records holding them.
+type Index struct {
+	Offsets []int64  // start of each record in file
+	Lengths []int32  // length of each record
+	KeyTags []string // tags used as keys
+	Keys    map[string][]int
+}
+
+// BuildIndex scans the binary MARC stream r and returns an Index of its
+// records. Records are delimited by the record length in their leader,
+// and only the directory is parsed, for records to be keyed on the values
+// of the given tags.
+func BuildIndex(r io.Reader, keyTags ...string) (*Index, error) {
+	idx := &Index{KeyTags: keyTags, Keys: make(map[string][]int)}
+	br := bufio.NewReaderSize(r, 1<<16)
+	var (
+		buf []byte
+		off int64
+	)
+	for {
+		head, err := br.Peek(5)
+		if err == io.EOF && len(head) == 0 {
+			return idx, nil
+		}
+		if err != nil {
+			return idx, fmt.Errorf("record %d at offset %d: %v", len(idx.Offsets), off, err)
+		}
+		n, ok := atoi(head)
+		if !ok || n < 24 {
+			return idx, fmt.Errorf("record %d at offset %d: leader pos 0:5 not a valid record length: %q", len(idx.Offsets), off, head)
+		}
+		if cap(buf) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return idx, fmt.Errorf("record %d at offset %d: %v", len(idx.Offsets), off, err)
+		}
+		if buf[n-1] != '\x1d' {
+			return idx, fmt.Errorf("record %d at offset %d: missing record terminator", len(idx.Offsets), off)
+		}
+		if len(keyTags) > 0 {
+			lr := LazyRecord{data: string(buf)}
+			if lr.dir, err = parseDirectory(buf, nil); err != nil {
+				return idx, fmt.Errorf("record %d at offset %d: %v", len(idx.Offsets), off, err)
+			}
+			for _, tag := range keyTags {
+				for _, v := range lr.keyValues(tag) {
+					k := indexKey(tag, v)
+					idx.Keys[k] = append(idx.Keys[k], len(idx.Offsets))
+				}
+			}
+		}
+		idx.Offsets = append(idx.Offsets, off)
+		idx.Lengths = append(idx.Lengths, int32(n))
+		off += int64(n)
+	}
+}
+
+// keyValues returns the values of the given tag used as index keys: the
+// value of control fields, and subfield $a of data fields.
+func (lr *LazyRecord) keyValues(tag string) []string {
+	var res []string
+	if f, ok := lr.GetCField(tag); ok {
+		res = append(res, f.Value)
+	}
+	for _, f := range lr.GetDFields(tag) {
+		for _, sf := range f.SubFields {
+			if sf.Code == "a" {
+				res = append(res, sf.Value)
+			}
+		}
+	}
+	return res
+}
+
+func indexKey(tag, value string) string {
+	return tag + "\x00" + value
+}
+
+// Len returns the number of records in the index.
+func (idx *Index) Len() int {
+	return len(idx.Offsets)
+}
+
+// Lookup returns the ordinals of the records where the given tag has the
+// given key value.
+func (idx *Index) Lookup(tag, value string) []int {
+	return idx.Keys[indexKey(tag, value)]
+}
+
+// Save writes the index to w, ex. a sidecar file next to the MARC file.
+func (idx *Index) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(idx)
+}
+
+// LoadIndex reads an index written by Save.
+func LoadIndex(r io.Reader) (*Index, error) {
+	idx := &Index{}
+	if err := gob.NewDecoder(r).Decode(idx); err != nil {
+		return nil, err
+	}
+	if len(idx.Offsets) != len(idx.Lengths) {
+		return nil, errors.New("corrupt index: offsets and lengths differ in number")
+	}
+	if idx.Keys == nil {
+		idx.Keys = make(map[string][]int)
+	}
+	return idx, nil
+}
+
+// ErrNotFound is returned when no record matches a lookup.
+var ErrNotFound = errors.New("record not found")
+
+// IndexedReader fetches single records from a binary MARC file by ordinal
+// or key, using an Index of the file.
+type IndexedReader struct {
+	r   io.ReaderAt
+	idx *Index
+}
+
+// NewIndexedReader returns a new IndexedReader, reading records from r as
+// located by idx.
+func NewIndexedReader(r io.ReaderAt, idx *Index) *IndexedReader {
+	return &IndexedReader{r: r, idx: idx}
+}
+
+// Index returns the Index used by the reader.
+func (ir *IndexedReader) Index() *Index {
+	return ir.idx
+}
+
+// Raw returns the raw bytes of record number i (counting from 0).
+func (ir *IndexedReader) Raw(i int) ([]byte, error) {
+	if i < 0 || i >= ir.idx.Len() {
+		return nil, fmt.Errorf("record %d out of range [0,%d)", i, ir.idx.Len())
+	}
+	b := make([]byte, ir.idx.Lengths[i])
+	if _, err := ir.r.ReadAt(b, ir.idx.Offsets[i]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Lazy returns record number i (counting from 0) as a LazyRecord. If the
+// reader is a MappedFile, the record references the mapped bytes.
+func (ir *IndexedReader) Lazy(i int) (*LazyRecord, error) {
+	if m, ok := ir.r.(*MappedFile); ok {
+		if i < 0 || i >= ir.idx.Len() {
+			return nil, fmt.Errorf("record %d out of range [0,%d)", i, ir.idx.Len())
+		}
+		return m.lazy(ir.idx.Offsets[i], int(ir.idx.Lengths[i]))
+	}
+	b, err := ir.Raw(i)
+	if err != nil {
+		return nil, err
+	}
+	return NewLazyRecord(b)
+}
+
+// Record returns record number i (counting from 0).
+func (ir *IndexedReader) Record(i int) (*Record, error) {
+	lr, err := ir.Lazy(i)
+	if err != nil {
+		return nil, err
+	}
+	return lr.Record(), nil
+}
+
+// Lookup returns the first record where the given tag has the given key
+// value, or ErrNotFound.
+func (ir *IndexedReader) Lookup(tag, value string) (*Record, error) {
+	ords := ir.idx.Lookup(tag, value)
+	if len(ords) == 0 {
+		return nil, ErrNotFound
+	}
+	return ir.Record(ords[0])
+}
@@ -0,0 +1,111 @@
+package marc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	input := numberedRecords(t, 100, MARC)
+	idx, err := BuildIndex(bytes.NewReader(input), DefaultIndexKeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 100 {
+		t.Fatalf("Len() => %d; want 100", idx.Len())
+	}
+
+	// Roundtrip through sidecar file
+	var b bytes.Buffer
+	if err := idx.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = LoadIndex(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ir := NewIndexedReader(bytes.NewReader(input), idx)
+	for _, i := range []int{0, 42, 99} {
+		r, err := ir.Record(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := recordID(r); id != i {
+			t.Errorf("Record(%d) => record %d", i, id)
+		}
+	}
+	if _, err := ir.Record(100); err == nil {
+		t.Error("Record(100) => nil error; want out of range error")
+	}
+
+	r, err := ir.Lookup("001", "57")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := recordID(r); id != 57 {
+		t.Errorf("Lookup(001, 57) => record %d", id)
+	}
+	if _, err := ir.Lookup("001", "1000"); err != ErrNotFound {
+		t.Errorf("Lookup(001, 1000) => %v; want %v", err, ErrNotFound)
+	}
+}
+
+func TestIndexDataFieldKeys(t *testing.T) {
+	idx, err := BuildIndex(strings.NewReader(sampleMARC+sampleMARC), "001", "020")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.Lookup("020", "0152038655 :"); len(got) != 2 || got[0] != 0 || got[1] != 1 {
+		t.Errorf("Lookup(020) => %v; want [0 1]", got)
+	}
+	if got := idx.Lookup("001", "   92005291 "); len(got) != 2 {
+		t.Errorf("Lookup(001) => %v; want [0 1]", got)
+	}
+	if idx.Offsets[1] != int64(len(sampleMARC)) {
+		t.Errorf("Offsets[1] => %d; want %d", idx.Offsets[1], len(sampleMARC))
+	}
+}
+
+func TestIndexMalformed(t *testing.T) {
+	tests := []string{
+		"abcde" + sampleMARC[5:],
+		sampleMARC[:len(sampleMARC)-10],
+		"01141" + sampleMARC[5:len(sampleMARC)-1],
+	}
+	for _, input := range tests {
+		if _, err := BuildIndex(strings.NewReader(input)); err == nil {
+			t.Errorf("BuildIndex(%q...) => nil error; want error", input[:30])
+		}
+	}
+}
+
+func BenchmarkBuildIndex(b *testing.B) {
+	input := strings.Repeat(sampleMARC, 100)
+	b.SetBytes(int64(len(input)))
+	for n := 0; n < b.N; n++ {
+		if _, err := BuildIndex(strings.NewReader(input), "001"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndexedRecord(b *testing.B) {
+	var input bytes.Buffer
+	for i := 0; i < 100; i++ {
+		input.WriteString(sampleMARC)
+	}
+	idx, err := BuildIndex(bytes.NewReader(input.Bytes()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	ir := NewIndexedReader(bytes.NewReader(input.Bytes()), idx)
+	b.SetBytes(int64(len(sampleMARC)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := ir.Record(n % 100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package marc
+
+import (
+	"fmt"
+	"slices"
+)
+
+// LazyRecord is a binary MARC record of which only the leader and directory
+// have been parsed. The raw record is kept, and fields are decoded only when
+// asked for, which is much cheaper when you need just a few fields out of
+// each record.
+type LazyRecord struct {
+	data string // raw record
+	dir  []dirEntry
+}
+
+// NewLazyRecord parses the leader and directory of the binary MARC record
+// in b. The record bytes are copied, so b can be reused afterwards.
+func NewLazyRecord(b []byte) (*LazyRecord, error) {
+	dir, err := parseDirectory(b, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LazyRecord{data: string(b), dir: dir}, nil
+}
+
+// DecodeLazy decodes the next record from the input stream as a LazyRecord.
+// It is only supported for binary MARC.
+func (d *Decoder) DecodeLazy() (*LazyRecord, error) {
+	if d.f != MARC {
+		return nil, fmt.Errorf("lazy decoding not supported for %v", d.f)
+	}
+	b, err := d.readMARC()
+	if err != nil {
+		return nil, err
+	}
+	lr, err := NewLazyRecord(b)
+	if err != nil {
+		return nil, &RecordError{err}
+	}
+	return lr, nil
+}
+
+// Leader returns the record leader.
+func (lr *LazyRecord) Leader() string {
+	return lr.data[0:24]
+}
+
+// Raw returns the raw binary MARC record.
+func (lr *LazyRecord) Raw() string {
+	return lr.data
+}
+
+// Tags returns the tags of all fields in the record, in directory order.
+func (lr *LazyRecord) Tags() []string {
+	res := make([]string, len(lr.dir))
+	for i, e := range lr.dir {
+		res[i] = e.tag
+	}
+	return res
+}
+
+// Has reports whether the record has a field with the given tag.
+func (lr *LazyRecord) Has(tag string) bool {
+	for _, e := range lr.dir {
+		if e.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCField returns the control field of the given tag, comma true,
+// or false if it does not exist.
+func (lr *LazyRecord) GetCField(tag string) (CField, bool) {
+	for _, e := range lr.dir {
+		if e.ctrl && e.tag == tag {
+			return CField{Tag: e.tag, Value: lr.data[e.start:e.end]}, true
+		}
+	}
+	return CField{}, false
+}
+
+// GetDFields returns the data fields of the given tag
+func (lr *LazyRecord) GetDFields(tag string) []DField {
+	res := make([]DField, 0)
+	for _, e := range lr.dir {
+		if !e.ctrl && e.tag == tag {
+			var f DField
+			decodeDField(&f, e.tag, lr.data[e.start:e.end])
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// Record decodes the fields with the given tags into a Record. If no tags
+// are given, all fields are decoded.
+func (lr *LazyRecord) Record(tags ...string) *Record {
+	r := NewRecord()
+	r.Leader = lr.Leader()
+	for _, e := range lr.dir {
+		if len(tags) > 0 && !slices.Contains(tags, e.tag) {
+			continue
+		}
+		if e.ctrl {
+			r.CtrlFields = append(r.CtrlFields, CField{Tag: e.tag, Value: lr.data[e.start:e.end]})
+			continue
+		}
+		decodeDField(r.nextDField(), e.tag, lr.data[e.start:e.end])
+	}
+	return r
+}
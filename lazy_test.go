@@ -0,0 +1,158 @@
+package marc
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLazyRecord(t *testing.T) {
+	want, err := NewDecoder(bytes.NewBufferString(sampleMARC), MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewBufferString(sampleMARC+sampleMARC), MARC)
+	for i := 0; i < 2; i++ {
+		lr, err := dec.DecodeLazy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lr.Leader() != want.Leader {
+			t.Errorf("Leader() => %q; want %q", lr.Leader(), want.Leader)
+		}
+		if lr.Raw() != sampleMARC {
+			t.Error("Raw() doesn't match input record")
+		}
+		if got := lr.Record(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Record() =>\n%v\nwant:\n%v", got, want)
+		}
+	}
+	if _, err := dec.DecodeLazy(); err == nil {
+		t.Error("DecodeLazy at end of stream => nil error; want io.EOF")
+	}
+}
+
+func TestLazyRecordFields(t *testing.T) {
+	lr, err := NewLazyRecord([]byte(sampleMARC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantTags := []string{"001", "003", "005", "008", "010", "020", "040", "042", "050", "082",
+		"100", "245", "250", "260", "300", "500", "520", "650", "650", "650", "650", "650", "700"}
+	if tags := lr.Tags(); !reflect.DeepEqual(tags, wantTags) {
+		t.Errorf("Tags() => %v; want %v", tags, wantTags)
+	}
+	if !lr.Has("245") || lr.Has("246") {
+		t.Error("Has() reports wrong presence of fields")
+	}
+
+	f, ok := lr.GetCField("003")
+	if !ok || f.Value != "DLC" {
+		t.Errorf("GetCField(003) => %v, %v; want DLC, true", f, ok)
+	}
+	if _, ok := lr.GetCField("245"); ok {
+		t.Error("GetCField(245) => true; want false")
+	}
+
+	fs := lr.GetDFields("650")
+	if len(fs) != 5 {
+		t.Fatalf("GetDFields(650) => %d fields; want 5", len(fs))
+	}
+	if fs[0].Ind2 != "0" || fs[0].SubField("x") != "Juvenile poetry." {
+		t.Errorf("GetDFields(650)[0] => %v", fs[0])
+	}
+
+	r := lr.Record("001", "245")
+	if len(r.CtrlFields) != 1 || len(r.DataFields) != 1 {
+		t.Fatalf("Record(001, 245) => %v", r)
+	}
+	if got := r.DataFields[0].SubField("a"); got != "Arithmetic /" {
+		t.Errorf("Record(001, 245) 245$a => %q; want %q", got, "Arithmetic /")
+	}
+}
+
+func TestLazyRecordUnsupportedFormat(t *testing.T) {
+	dec := NewDecoder(bytes.NewBufferString(sampleLineMARC), LineMARC)
+	if _, err := dec.DecodeLazy(); err == nil {
+		t.Error("DecodeLazy on LineMARC => nil error; want error")
+	}
+}
+
+func TestDecoderSelectTags(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		f     Format
+	}{
+		{sampleMARC + sampleMARC, MARC},
+		{sampleMARCXML, MARCXML},
+	} {
+		dec := NewDecoder(bytes.NewBufferString(test.input), test.f)
+		dec.SelectTags("001", "650")
+		r := NewRecord()
+		if err := dec.DecodeInto(r); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.CtrlFields) != 1 || r.CtrlFields[0].Tag != "001" {
+			t.Errorf("%v: control fields => %v; want only 001", test.f, r.CtrlFields)
+		}
+		if len(r.DataFields) != 5 {
+			t.Errorf("%v: got %d data fields; want 5", test.f, len(r.DataFields))
+		}
+		for _, f := range r.DataFields {
+			if f.Tag != "650" {
+				t.Errorf("%v: got unselected field %s", test.f, f.Tag)
+			}
+		}
+	}
+
+	// Selection on LineMARC must not leave reused subfields aliased.
+	input := `*100 0$aKarlén, Barbro
+*24510$aI begynnelsen skapte Gud
+^
+*24510$aSecond$bsubtitle
+*7001 $aOther
+^
+`
+	dec := NewDecoder(strings.NewReader(input), LineMARC)
+	dec.SelectTags("245")
+	r := NewRecord()
+	for _, want := range []string{"I begynnelsen skapte Gud", "Second"} {
+		if err := dec.DecodeInto(r); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.DataFields) != 1 || r.DataFields[0].SubField("a") != want {
+			t.Errorf("SelectTags(245) => %v; want 245$a %q", r.DataFields, want)
+		}
+	}
+}
+
+func BenchmarkDecodeLazyMARC(b *testing.B) {
+	dec := NewDecoder(strings.NewReader(strings.Repeat(sampleMARC, b.N)), MARC)
+	b.SetBytes(int64(len(sampleMARC)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		lr, err := dec.DecodeLazy()
+		if err != nil {
+			b.Fatal(err)
+		}
+		lr.GetCField("001")
+		lr.GetDFields("020")
+		lr.GetDFields("245")
+	}
+}
+
+func BenchmarkDecodeSelectedMARC(b *testing.B) {
+	dec := NewDecoder(strings.NewReader(strings.Repeat(sampleMARC, b.N)), MARC)
+	dec.SelectTags("001", "020", "245")
+	r := NewRecord()
+	b.SetBytes(int64(len(sampleMARC)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := dec.DecodeInto(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// MappedFile is a binary MARC file mapped into memory. Records decoded from
+// it reference the mapped bytes directly, without copying, which makes it
+// the fastest way to read a local file.
+//
+// The strings of records decoded from a MappedFile are only valid until
+// the file is closed; accessing them after Close will crash the program.
+// Copy out (ex. with strings.Clone) any values you need to keep.
+type MappedFile struct {
+	data []byte
+}
+
+// OpenMapped maps the named binary MARC file into memory for reading. On
+// platforms without mmap support the file is read into memory instead.
+func OpenMapped(name string) (*MappedFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &MappedFile{}, nil
+	}
+	if int64(int(fi.Size())) != fi.Size() {
+		return nil, fmt.Errorf("%s: file too large to map", name)
+	}
+	data, err := mmap(f, int(fi.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &MappedFile{data: data}, nil
+}
+
+// Close unmaps the file.
+func (m *MappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
+
+// Bytes returns the mapped file contents.
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+// Len returns the size of the file.
+func (m *MappedFile) Len() int {
+	return len(m.data)
+}
+
+// ReadAt implements io.ReaderAt, so that the file can be indexed with
+// BuildIndex, and read with an IndexedReader. The IndexedReader detects a
+// MappedFile, and returns records referencing the mapped bytes.
+func (m *MappedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// lazy returns the record at the given offset and length as a LazyRecord
+// referencing the mapped bytes.
+func (m *MappedFile) lazy(off int64, n int) (*LazyRecord, error) {
+	if off < 0 || off+int64(n) > int64(len(m.data)) {
+		return nil, fmt.Errorf("record at offset %d, length %d out of bounds", off, n)
+	}
+	b := m.data[off : off+int64(n)]
+	dir, err := parseDirectory(b, nil)
+	if err != nil {
+		return nil, &RecordError{err}
+	}
+	return &LazyRecord{data: byteString(b), dir: dir}, nil
+}
+
+// NewDecoder returns a MappedDecoder, reading the records of the file from
+// the start.
+func (m *MappedFile) NewDecoder() *MappedDecoder {
+	return &MappedDecoder{m: m}
+}
+
+// MappedDecoder decodes binary MARC records from a MappedFile.
+type MappedDecoder struct {
+	m    *MappedFile
+	pos  int // position in m.data
+	dir  []dirEntry
+	tags map[string]bool
+}
+
+// next returns the next raw record.
+func (d *MappedDecoder) next() ([]byte, error) {
+	const recordTerminator = '\x1d'
+
+	rest := d.m.data[d.pos:]
+	n := bytes.IndexByte(rest, recordTerminator) + 1
+	if n == 0 {
+		n = len(rest)
+	}
+	d.pos += n
+	if n < 24 {
+		return nil, io.EOF
+	}
+	return rest[:n], nil
+}
+
+// Decode decodes the next record.
+func (d *MappedDecoder) Decode() (*Record, error) {
+	r := NewRecord()
+	err := d.DecodeInto(r)
+	return r, err
+}
+
+// DecodeInto decodes the next record into r, like Decoder.DecodeInto.
+func (d *MappedDecoder) DecodeInto(r *Record) error {
+	r.reset()
+	b, err := d.next()
+	if err != nil {
+		return err
+	}
+	d.dir, err = decodeMARCRecord(b, byteString(b), r, d.dir[:0], d.tags)
+	return err
+}
+
+// DecodeLazy decodes the next record as a LazyRecord.
+func (d *MappedDecoder) DecodeLazy() (*LazyRecord, error) {
+	b, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := parseDirectory(b, nil)
+	if err != nil {
+		return nil, &RecordError{err}
+	}
+	return &LazyRecord{data: byteString(b), dir: dir}, nil
+}
+
+// SelectTags restricts decoding to fields with the given tags, like
+// Decoder.SelectTags.
+func (d *MappedDecoder) SelectTags(tags ...string) {
+	if len(tags) == 0 {
+		d.tags = nil
+		return
+	}
+	d.tags = make(map[string]bool, len(tags))
+	for _, t := range tags {
+		d.tags[t] = true
+	}
+}
+
+// byteString returns a string sharing memory with b, which must not be
+// modified while the string is in use.
+func byteString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
@@ -0,0 +1,136 @@
+package marc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeTempFile(t testing.TB, data []byte) string {
+	name := filepath.Join(t.TempDir(), "db.mrc")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestMappedDecoder(t *testing.T) {
+	input := numberedRecords(t, 50, MARC)
+	m, err := OpenMapped(writeTempFile(t, input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.Len() != len(input) {
+		t.Errorf("Len() => %d; want %d", m.Len(), len(input))
+	}
+
+	want, err := NewDecoder(bytes.NewReader(input), MARC).DecodeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := m.NewDecoder()
+	r := NewRecord()
+	for i, w := range want {
+		if err := dec.DecodeInto(r); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r, w) {
+			t.Errorf("record %d =>\n%v\nwant:\n%v", i, r, w)
+		}
+	}
+	if err := dec.DecodeInto(r); err != io.EOF {
+		t.Errorf("DecodeInto at end of file => %v; want io.EOF", err)
+	}
+}
+
+func TestMappedLazyAndSelect(t *testing.T) {
+	m, err := OpenMapped(writeTempFile(t, []byte(sampleMARC+sampleMARC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	dec := m.NewDecoder()
+	lr, err := dec.DecodeLazy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr.Raw() != sampleMARC {
+		t.Error("DecodeLazy: raw record doesn't match input")
+	}
+
+	dec.SelectTags("245")
+	r, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.CtrlFields) != 0 || len(r.DataFields) != 1 || r.DataFields[0].SubField("a") != "Arithmetic /" {
+		t.Errorf("SelectTags(245) => %v", r)
+	}
+}
+
+func TestMappedIndexedReader(t *testing.T) {
+	input := numberedRecords(t, 50, MARC)
+	m, err := OpenMapped(writeTempFile(t, input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	idx, err := BuildIndex(bytes.NewReader(m.Bytes()), "001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir := NewIndexedReader(m, idx)
+	r, err := ir.Lookup("001", "33")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := recordID(r); id != 33 {
+		t.Errorf("Lookup(001, 33) => record %d", id)
+	}
+	b, err := ir.Raw(33)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := input[idx.Offsets[33] : idx.Offsets[33]+int64(idx.Lengths[33])]; !bytes.Equal(b, want) {
+		t.Error("Raw(33) doesn't match input")
+	}
+	if _, err := ir.Lazy(50); err == nil {
+		t.Error("Lazy(50) => nil error; want out of range error")
+	}
+}
+
+func TestMappedEmptyFile(t *testing.T) {
+	m, err := OpenMapped(writeTempFile(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.NewDecoder().Decode(); err != io.EOF {
+		t.Errorf("Decode on empty file => %v; want io.EOF", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func BenchmarkMappedDecodeInto(b *testing.B) {
+	m, err := OpenMapped(writeTempFile(b, bytes.Repeat([]byte(sampleMARC), b.N)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer m.Close()
+	dec := m.NewDecoder()
+	r := NewRecord()
+	b.SetBytes(int64(len(sampleMARC)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := dec.DecodeInto(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
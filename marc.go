@@ -6,6 +6,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"slices"
 	"sort"
 	"strings"
 	"unicode/utf8"
@@ -106,11 +107,56 @@ func (f SubFields) Less(i, j int) bool {
 	return false
 }
 
+// reset empties r, keeping the capacity of its field slices for reuse.
+func (r *Record) reset() {
+	r.Leader = ""
+	r.CtrlFields = r.CtrlFields[:0]
+	r.DataFields = r.DataFields[:0]
+}
+
+// nextDField appends an empty data field to r and returns a pointer to it.
+// The subfield slice of a previously decoded field is reused if available.
+// The pointer is only valid until the next call to nextDField.
+func (r *Record) nextDField() *DField {
+	n := len(r.DataFields)
+	if n < cap(r.DataFields) {
+		r.DataFields = r.DataFields[:n+1]
+		f := &r.DataFields[n]
+		f.SubFields = f.SubFields[:0]
+		return f
+	}
+	r.DataFields = append(r.DataFields, DField{})
+	return &r.DataFields[n]
+}
+
+// keepTags removes all fields whose tag is not in tags. Removed data fields
+// are swapped past the end of the slice, so their subfield slices can still
+// be reused without aliasing the kept ones.
+func (r *Record) keepTags(tags map[string]bool) {
+	n := 0
+	for _, f := range r.CtrlFields {
+		if tags[f.Tag] {
+			r.CtrlFields[n] = f
+			n++
+		}
+	}
+	r.CtrlFields = r.CtrlFields[:n]
+
+	n = 0
+	for i := range r.DataFields {
+		if tags[r.DataFields[i].Tag] {
+			r.DataFields[n], r.DataFields[i] = r.DataFields[i], r.DataFields[n]
+			n++
+		}
+	}
+	r.DataFields = r.DataFields[:n]
+}
+
 // SetCField sets the given control field, replacing any existing control
 // field with same tag.
 func (r *Record) SetCField(f CField) {
-	for i, f := range r.CtrlFields {
-		if f.Tag == f.Tag {
+	for i, cf := range r.CtrlFields {
+		if cf.Tag == f.Tag {
 			r.CtrlFields[i] = f
 			return
 		}
@@ -145,6 +191,86 @@ func (r *Record) AddDField(f DField) {
 	r.DataFields = append(r.DataFields, f)
 }
 
+// MatchTag reports whether tag matches pattern. A pattern is either a tag,
+// where X (or x) matches any character, as in "6XX" or "1X0"; or an
+// inclusive range of tags, as in "600-651".
+func MatchTag(pattern, tag string) bool {
+	if lo, hi, ok := strings.Cut(pattern, "-"); ok {
+		return len(tag) == len(lo) && lo <= tag && tag <= hi
+	}
+	if len(pattern) != len(tag) {
+		return false
+	}
+	for i := 0; i < len(pattern); i++ {
+		if c := pattern[i]; c != 'X' && c != 'x' && c != tag[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchCFields returns the control fields with tags matching pattern (see
+// MatchTag), in record order.
+func (r *Record) MatchCFields(pattern string) []CField {
+	var res []CField
+	for _, f := range r.CtrlFields {
+		if MatchTag(pattern, f.Tag) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// MatchDFields returns the data fields with tags matching pattern (see
+// MatchTag), in record order.
+func (r *Record) MatchDFields(pattern string) []DField {
+	var res []DField
+	for _, f := range r.DataFields {
+		if MatchTag(pattern, f.Tag) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// IndexDFields returns the indexes in DataFields of the data fields with
+// tags matching pattern (see MatchTag), for use with ReplaceDField.
+func (r *Record) IndexDFields(pattern string) []int {
+	var res []int
+	for i, f := range r.DataFields {
+		if MatchTag(pattern, f.Tag) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// RemoveFields removes all control and data fields with tags matching
+// pattern (see MatchTag), and returns the number of fields removed.
+func (r *Record) RemoveFields(pattern string) int {
+	n := len(r.CtrlFields) + len(r.DataFields)
+	r.CtrlFields = slices.DeleteFunc(r.CtrlFields, func(f CField) bool { return MatchTag(pattern, f.Tag) })
+	r.DataFields = slices.DeleteFunc(r.DataFields, func(f DField) bool { return MatchTag(pattern, f.Tag) })
+	return n - len(r.CtrlFields) - len(r.DataFields)
+}
+
+// InsertDFieldSorted inserts the data field before the first data field with
+// a greater tag, so that it follows any fields with the same tag. If the
+// data fields are sorted by tag, they remain so.
+func (r *Record) InsertDFieldSorted(f DField) {
+	i := slices.IndexFunc(r.DataFields, func(df DField) bool { return df.Tag > f.Tag })
+	if i < 0 {
+		i = len(r.DataFields)
+	}
+	r.DataFields = slices.Insert(r.DataFields, i, f)
+}
+
+// ReplaceDField replaces data field number i (counting from 0) with f. It
+// panics if i is out of range, like indexing DataFields.
+func (r *Record) ReplaceDField(i int, f DField) {
+	r.DataFields[i] = f
+}
+
 func NewDField(tag string) DField {
 	return DField{
 		Tag:  tag,
@@ -153,6 +279,9 @@ func NewDField(tag string) DField {
 	}
 }
 
+// SubField returns the value of the first subfield with the given code, or
+// the empty string if there is none. See SubFieldValues for repeated
+// subfields.
 func (f DField) SubField(code string) string {
 	for _, f := range f.SubFields {
 		if f.Code == code {
@@ -162,6 +291,18 @@ func (f DField) SubField(code string) string {
 	return ""
 }
 
+// SubFieldValues returns the values of all subfields with the given code,
+// in field order.
+func (f DField) SubFieldValues(code string) []string {
+	var res []string
+	for _, sf := range f.SubFields {
+		if sf.Code == code {
+			res = append(res, sf.Value)
+		}
+	}
+	return res
+}
+
 func (f DField) AddSubField(code, value string) DField {
 	f.SubFields = append(f.SubFields, SubField{
 		Code:  code,
@@ -170,121 +311,160 @@ func (f DField) AddSubField(code, value string) DField {
 	return f
 }
 
-// Eq tests for Record equality.
-func (r *Record) Eq(other *Record) bool {
-
-	// We disregard leader in equality tests, since LineMARC doesn't have one,
-	// and it will be generated by decoders and encoder.
-	/*
-		// Leader equal?
-		if r.Leader != other.Leader {
-			return false
+// SetSubField returns the field with the value of the first subfield with
+// the given code set to value, or with the subfield added at the end if
+// there is none. The subfields of f are not modified.
+func (f DField) SetSubField(code, value string) DField {
+	f.SubFields = slices.Clone(f.SubFields)
+	for i, sf := range f.SubFields {
+		if sf.Code == code {
+			f.SubFields[i].Value = value
+			return f
 		}
-	*/
-
-	// Control Fields equal?
-	if len(r.CtrlFields) != len(other.CtrlFields) {
-		return false
 	}
+	return f.AddSubField(code, value)
+}
+
+// RemoveSubFields returns the field without the subfields with the given
+// code. The subfields of f are not modified.
+func (f DField) RemoveSubFields(code string) DField {
+	f.SubFields = slices.DeleteFunc(slices.Clone(f.SubFields), func(sf SubField) bool { return sf.Code == code })
+	return f
+}
 
-	sort.Sort(r.CtrlFields)
-	sort.Sort(other.CtrlFields)
+// EqualOptions control how records are compared by Equal.
+type EqualOptions struct {
+	Leader        bool // compare leaders
+	FieldOrder    bool // the order of fields must be the same
+	SubFieldOrder bool // the order of subfields must be the same
+}
 
-	for i, f := range r.CtrlFields {
-		if other.CtrlFields[i] != f {
-			return false
-		}
+// Equal tests for Record equality. By default the leader is disregarded,
+// since LineMARC doesn't have one, and it will be generated by decoders and
+// encoder; and the order of fields and subfields doesn't matter. The
+// records are not modified.
+func (r *Record) Equal(other *Record, opts EqualOptions) bool {
+	if opts.Leader && r.Leader != other.Leader {
+		return false
 	}
-
-	// Data Fields equal?
-	if len(r.DataFields) != len(other.DataFields) {
+	if len(r.CtrlFields) != len(other.CtrlFields) || len(r.DataFields) != len(other.DataFields) {
 		return false
 	}
+	return slices.Equal(r.fieldKeys(opts), other.fieldKeys(opts))
+}
 
-	sort.Sort(r.DataFields)
-	sort.Sort(other.DataFields)
+// Eq tests for Record equality, disregarding leader and order of fields and
+// subfields.
+//
+// Deprecated: Use Equal, which also lets you choose what to compare.
+func (r *Record) Eq(other *Record) bool {
+	return r.Equal(other, EqualOptions{})
+}
 
-	for i, f := range r.DataFields {
-		if o := other.DataFields[i]; o.Tag != f.Tag || o.Ind1 != f.Ind1 || o.Ind2 != f.Ind2 {
-			return false
-		}
-		// SubFields equal?
-		if len(f.SubFields) != len(other.DataFields[i].SubFields) {
-			return false
+// fieldKeys returns a string key for each field of r, such that two records
+// are equal under opts if their keys are equal.
+func (r *Record) fieldKeys(opts EqualOptions) []string {
+	keys := make([]string, 0, len(r.CtrlFields)+len(r.DataFields))
+	for _, f := range r.CtrlFields {
+		keys = append(keys, f.Tag+"\x1e"+f.Value)
+	}
+	var subs []string
+	for _, f := range r.DataFields {
+		subs = subs[:0]
+		for _, sf := range f.SubFields {
+			subs = append(subs, sf.Code+sf.Value)
 		}
-
-		sort.Sort(f.SubFields)
-		sort.Sort(other.DataFields[i].SubFields)
-
-		for j, s := range f.SubFields {
-			if other.DataFields[i].SubFields[j] != s {
-				return false
-			}
+		if !opts.SubFieldOrder {
+			sort.Strings(subs)
 		}
+		keys = append(keys, f.Tag+"\x1e"+f.Ind1+"\x1e"+f.Ind2+"\x1f"+strings.Join(subs, "\x1f"))
 	}
-
-	// All fields equal
-	return true
+	if !opts.FieldOrder {
+		sort.Strings(keys)
+	}
+	return keys
 }
 
 // DumpTo dumps a Record to the give writer
 func (r *Record) DumpTo(w io.Writer, colors bool) {
-	bold, reset, faint, green := "", "", "", ""
-	if colors {
-		bold = "\x1b[1m"
-		reset = "\x1b[0m"
-		faint = "\x1b[2m"
-		green = "\x1b[32m"
+	st := newDumpStyle(colors)
+	fmt.Fprintln(w, r.Leader)
+	for _, c := range r.CtrlFields {
+		st.dumpCField(w, c)
+	}
+	for _, d := range r.DataFields {
+		st.dumpDField(w, d, "")
 	}
+	fmt.Fprintf(w, "\n")
+}
+
+// dumpStyle holds the terminal escape codes used by DumpTo, which are empty
+// without colors.
+type dumpStyle struct {
+	bold, reset, faint, green, red string
+}
 
+func newDumpStyle(colors bool) dumpStyle {
+	if !colors {
+		return dumpStyle{}
+	}
+	return dumpStyle{
+		bold:  "\x1b[1m",
+		reset: "\x1b[0m",
+		faint: "\x1b[2m",
+		green: "\x1b[32m",
+		red:   "\x1b[31m",
+	}
+}
+
+func (st dumpStyle) dumpCField(w io.Writer, c CField) {
+	fmt.Fprintf(w, "%s%s%s %s\n", st.bold, c.Tag, st.reset, c.Value)
+}
+
+// dumpDField writes d, wrapping long lines. Wrapped lines are prefixed
+// with indent, in addition to the usual indentation.
+func (st dumpStyle) dumpDField(w io.Writer, d DField, indent string) {
 	orBlank := func(s string) string {
 		if len(s) == 0 || s == " " {
 			return "_"
 		}
 		return s
 	}
-	fmt.Fprintln(w, r.Leader)
-	for _, c := range r.CtrlFields {
-		fmt.Fprintf(w, "%s%s%s %s\n", bold, c.Tag, reset, c.Value)
-	}
-	for _, d := range r.DataFields {
-		fmt.Fprintf(w, "%s%s %s%s%s%s ",
-			bold, d.Tag, faint, orBlank(d.Ind1), orBlank(d.Ind2), reset)
+	fmt.Fprintf(w, "%s%s %s%s%s%s ",
+		st.bold, d.Tag, st.faint, orBlank(d.Ind1), orBlank(d.Ind2), st.reset)
 
-		var b bytes.Buffer
-		for _, s := range d.SubFields {
-			fmt.Fprintf(&b, "|%s %s ", s.Code, s.Value)
-		}
-		fields := strings.Fields(b.String())
-
-		// current rune-count in line
-		c := 0
-
-		for _, f := range fields {
-			wlen := utf8.RuneCountInString(f)
-			if c+wlen > colWidth {
-				// Wrap to new line and indent
-				w.Write([]byte("\n       "))
-				c = 0
-				if f[0] != '|' {
-					// Not subfield code; indent along with start of text in above line
-					w.Write([]byte("   "))
-					c += 2
-				}
-			}
-			if f[0] == '|' {
-				// subfield code, with color escape
-				fmt.Fprintf(w, "%s%s%s", green, f, reset)
-			} else {
-				// subfield value
-				w.Write([]byte(f))
+	var b bytes.Buffer
+	for _, s := range d.SubFields {
+		fmt.Fprintf(&b, "|%s %s ", s.Code, s.Value)
+	}
+	fields := strings.Fields(b.String())
+
+	// current rune-count in line
+	c := 0
+
+	for _, f := range fields {
+		wlen := utf8.RuneCountInString(f)
+		if c+wlen > colWidth {
+			// Wrap to new line and indent
+			w.Write([]byte("\n" + indent + "       "))
+			c = 0
+			if f[0] != '|' {
+				// Not subfield code; indent along with start of text in above line
+				w.Write([]byte("   "))
+				c += 2
 			}
-
-			// Write again space stripped by strings.Fields
-			w.Write([]byte(" "))
-			c += wlen + 1
 		}
-		fmt.Fprintf(w, "\n")
+		if f[0] == '|' {
+			// subfield code, with color escape
+			fmt.Fprintf(w, "%s%s%s", st.green, f, st.reset)
+		} else {
+			// subfield value
+			w.Write([]byte(f))
+		}
+
+		// Write again space stripped by strings.Fields
+		w.Write([]byte(" "))
+		c += wlen + 1
 	}
 	fmt.Fprintf(w, "\n")
 }
@@ -3,6 +3,7 @@ package marc
 import (
 	"bytes"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -277,8 +278,222 @@ func TestManipulateRecord(t *testing.T) {
 	}
 
 	wantRec.Leader = ""
-	if !wantRec.Eq(got) {
+	if !wantRec.Equal(got, EqualOptions{}) {
 		t.Errorf("got:\n%v\nwant:\n%v", got, wantRec)
 	}
 
 }
+
+func TestRecordEqual(t *testing.T) {
+	newRec := func(leader string, fields ...DField) *Record {
+		r := NewRecord()
+		r.Leader = leader
+		r.CtrlFields = CFields{{Tag: "001", Value: "1"}}
+		r.DataFields = fields
+		return r
+	}
+	f100 := NewDField("100").AddSubField("a", "Doe, John").AddSubField("d", "1900-")
+	f245 := NewDField("245").AddSubField("a", "Title").AddSubField("b", "subtitle")
+	f245r := NewDField("245").AddSubField("b", "subtitle").AddSubField("a", "Title")
+
+	tests := []struct {
+		a, b *Record
+		opts EqualOptions
+		want bool
+	}{
+		{newRec("a", f100, f245), newRec("b", f100, f245), EqualOptions{}, true},
+		{newRec("a", f100, f245), newRec("b", f100, f245), EqualOptions{Leader: true}, false},
+		{newRec("a", f100, f245), newRec("a", f245, f100), EqualOptions{}, true},
+		{newRec("a", f100, f245), newRec("a", f245, f100), EqualOptions{FieldOrder: true}, false},
+		{newRec("a", f100, f245), newRec("a", f100, f245r), EqualOptions{FieldOrder: true}, true},
+		{newRec("a", f100, f245), newRec("a", f100, f245r), EqualOptions{SubFieldOrder: true}, false},
+		{newRec("a", f100, f245), newRec("a", f100), EqualOptions{}, false},
+		{newRec("a", f245, f245), newRec("a", f245, f245r), EqualOptions{}, true},
+	}
+
+	for i, test := range tests {
+		before := dumpString(test.a) + dumpString(test.b)
+		if got := test.a.Equal(test.b, test.opts); got != test.want {
+			t.Errorf("%d: Equal(%+v) => %v; want %v", i, test.opts, got, test.want)
+		}
+		if after := dumpString(test.a) + dumpString(test.b); after != before {
+			t.Errorf("%d: Equal modified the records:\n%s\nwant:\n%s", i, after, before)
+		}
+	}
+}
+
+func TestSetCField(t *testing.T) {
+	r := NewRecord()
+	r.CtrlFields = CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: "2020"}}
+	r.SetCField(CField{Tag: "005", Value: "2021"})
+	r.SetCField(CField{Tag: "008", Value: "x"})
+	want := CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: "2021"}, {Tag: "008", Value: "x"}}
+	if !reflect.DeepEqual(r.CtrlFields, want) {
+		t.Errorf("SetCField => %v; want %v", r.CtrlFields, want)
+	}
+}
+
+func TestMatchTag(t *testing.T) {
+	tests := []struct {
+		pattern, tag string
+		want         bool
+	}{
+		{"245", "245", true},
+		{"245", "246", false},
+		{"6XX", "650", true},
+		{"6xx", "600", true},
+		{"6XX", "700", false},
+		{"1X0", "110", true},
+		{"1X0", "111", false},
+		{"XXX", "001", true},
+		{"600-651", "600", true},
+		{"600-651", "651", true},
+		{"600-651", "655", false},
+		{"600-651", "59", false},
+		{"24", "245", false},
+	}
+	for _, test := range tests {
+		if got := MatchTag(test.pattern, test.tag); got != test.want {
+			t.Errorf("MatchTag(%q, %q) => %v; want %v", test.pattern, test.tag, got, test.want)
+		}
+	}
+}
+
+func tags(r *Record) []string {
+	var res []string
+	for _, f := range r.CtrlFields {
+		res = append(res, f.Tag)
+	}
+	for _, f := range r.DataFields {
+		res = append(res, f.Tag+f.SubField("a"))
+	}
+	return res
+}
+
+func manipulationTestRecord() *Record {
+	r := NewRecord()
+	r.CtrlFields = CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: "2020"}, {Tag: "008", Value: "x"}}
+	r.DataFields = DFields{
+		NewDField("100").AddSubField("a", "1"),
+		NewDField("245").AddSubField("a", "1"),
+		NewDField("650").AddSubField("a", "1"),
+		NewDField("650").AddSubField("a", "2"),
+		NewDField("651").AddSubField("a", "1"),
+		NewDField("700").AddSubField("a", "1"),
+	}
+	return r
+}
+
+func TestFieldLookup(t *testing.T) {
+	r := manipulationTestRecord()
+	var got []string
+	for _, f := range r.MatchDFields("6XX") {
+		got = append(got, f.Tag+f.SubField("a"))
+	}
+	if want := []string{"6501", "6502", "6511"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchDFields(6XX) => %v; want %v", got, want)
+	}
+	if got := r.MatchCFields("00X"); len(got) != 3 {
+		t.Errorf("MatchCFields(00X) => %v; want 3 fields", got)
+	}
+	if got, want := r.IndexDFields("245-650"), []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexDFields(245-650) => %v; want %v", got, want)
+	}
+}
+
+func TestRemoveFields(t *testing.T) {
+	tests := []struct {
+		pattern string
+		n       int
+		want    []string
+	}{
+		{"650", 2, []string{"001", "005", "008", "1001", "2451", "6511", "7001"}},
+		{"6XX", 3, []string{"001", "005", "008", "1001", "2451", "7001"}},
+		{"005", 1, []string{"001", "008", "1001", "2451", "6501", "6502", "6511", "7001"}},
+		{"000-199", 4, []string{"2451", "6501", "6502", "6511", "7001"}},
+		{"900", 0, []string{"001", "005", "008", "1001", "2451", "6501", "6502", "6511", "7001"}},
+	}
+	for _, test := range tests {
+		r := manipulationTestRecord()
+		if n := r.RemoveFields(test.pattern); n != test.n {
+			t.Errorf("RemoveFields(%q) => %d; want %d", test.pattern, n, test.n)
+		}
+		if got := tags(r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RemoveFields(%q) left %v; want %v", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestInsertDFieldSorted(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{"020", []string{"001", "005", "008", "020x", "1001", "2451", "6501", "6502", "6511", "7001"}},
+		{"650", []string{"001", "005", "008", "1001", "2451", "6501", "6502", "650x", "6511", "7001"}},
+		{"500", []string{"001", "005", "008", "1001", "2451", "500x", "6501", "6502", "6511", "7001"}},
+		{"999", []string{"001", "005", "008", "1001", "2451", "6501", "6502", "6511", "7001", "999x"}},
+	}
+	for _, test := range tests {
+		r := manipulationTestRecord()
+		r.InsertDFieldSorted(NewDField(test.tag).AddSubField("a", "x"))
+		if got := tags(r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("InsertDFieldSorted(%s) => %v; want %v", test.tag, got, test.want)
+		}
+	}
+
+	r := NewRecord()
+	r.InsertDFieldSorted(NewDField("245").AddSubField("a", "1"))
+	if got, want := tags(r), []string{"2451"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InsertDFieldSorted in empty record => %v; want %v", got, want)
+	}
+}
+
+func TestReplaceDField(t *testing.T) {
+	r := manipulationTestRecord()
+	i := r.IndexDFields("650")[1]
+	r.ReplaceDField(i, NewDField("655").AddSubField("a", "x"))
+	want := []string{"001", "005", "008", "1001", "2451", "6501", "655x", "6511", "7001"}
+	if got := tags(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReplaceDField => %v; want %v", got, want)
+	}
+}
+
+func TestSubFieldManipulation(t *testing.T) {
+	f := NewDField("650").
+		AddSubField("a", "Cats").
+		AddSubField("x", "History").
+		AddSubField("x", "Juvenile literature").
+		AddSubField("2", "lcsh")
+	orig := dumpString(&Record{DataFields: DFields{f}})
+
+	if got, want := f.SubFieldValues("x"), []string{"History", "Juvenile literature"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SubFieldValues(x) => %v; want %v", got, want)
+	}
+	if got := f.SubFieldValues("z"); len(got) != 0 {
+		t.Errorf("SubFieldValues(z) => %v; want none", got)
+	}
+
+	tests := []struct {
+		name string
+		f    DField
+		want SubFields
+	}{
+		{"SetSubField existing", f.SetSubField("x", "Fiction"),
+			SubFields{{"a", "Cats"}, {"x", "Fiction"}, {"x", "Juvenile literature"}, {"2", "lcsh"}}},
+		{"SetSubField new", f.SetSubField("v", "Pictorial works"),
+			SubFields{{"a", "Cats"}, {"x", "History"}, {"x", "Juvenile literature"}, {"2", "lcsh"}, {"v", "Pictorial works"}}},
+		{"RemoveSubFields", f.RemoveSubFields("x"),
+			SubFields{{"a", "Cats"}, {"2", "lcsh"}}},
+		{"RemoveSubFields none", f.RemoveSubFields("z"),
+			SubFields{{"a", "Cats"}, {"x", "History"}, {"x", "Juvenile literature"}, {"2", "lcsh"}}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.f.SubFields, test.want) {
+			t.Errorf("%s => %v; want %v", test.name, test.f.SubFields, test.want)
+		}
+	}
+	if after := dumpString(&Record{DataFields: DFields{f}}); after != orig {
+		t.Errorf("original field modified:\n%s\nwant:\n%s", after, orig)
+	}
+}
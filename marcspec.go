@@ -0,0 +1,643 @@
+package marc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MARCSpec is a parsed MARCspec, a path expression selecting data from a
+// record, as described at https://marcspec.github.io/MARCspec/. Supported are:
+//
+//	LDR/6             leader, character positions
+//	007/0-1           control field, character positions
+//	245               all subfield values of a field
+//	6XX, 6..          tag wildcards
+//	700[0], 700[#]    field repetitions, by index or range, # for last
+//	245$a, 245$a$c    subfields
+//	650$a-c           subfield code range
+//	650$x[0]          subfield repetitions
+//	245$a/0-3         character positions of subfield values
+//	245^1             indicators
+//	650$a{$2=\lcsh}   subfield and field conditions ("subspecs")
+//
+// A subspec is a condition in braces, which can follow the field, a subfield
+// or an indicator, and must hold for the data to be selected. Conditions
+// compare two terms: a MARCspec, or a comparison string prefixed by a
+// backslash. The operators are = (equal), != (not equal), ~ (includes), !~
+// (does not include), ? (exists) and ! (does not exist). A term can be an
+// abbreviated MARCspec, such as $2, ^1 or /0-3, relative to the field or
+// value being tested. With the left term left out, as in {~\Poe}, it is the
+// value being tested. Conditions separated by | inside the braces are
+// alternatives; several subspecs must all hold.
+//
+// As an extension, a comparison string not starting with a backslash is
+// accepted, as in 650$a{$2=lcsh}, when it is not a valid MARCspec.
+type MARCSpec struct {
+	src string
+
+	tag      string // tag pattern (see MatchTag), "LDR", or empty if relative
+	index    *posRange
+	chars    *posRange
+	subSpecs []subSpec
+
+	subfields []subfieldSpec
+	ind       int // indicator 1 or 2, 0 if none
+	indSpecs  []subSpec
+}
+
+type posRange struct {
+	from, to int // -1 means last
+}
+
+type subfieldSpec struct {
+	from, to byte // code range
+	index    *posRange
+	chars    *posRange
+	subSpecs []subSpec
+}
+
+// subSpec is a set of alternative conditions.
+type subSpec []condition
+
+type condition struct {
+	left  *specTerm // nil for the value being tested
+	op    string
+	right *specTerm
+}
+
+type specTerm struct {
+	spec *MARCSpec // nil for comparison strings
+	str  string
+}
+
+// ParseMARCSpec parses a MARCspec.
+func ParseMARCSpec(s string) (*MARCSpec, error) {
+	p := &specParser{s: s}
+	spec, err := p.spec()
+	if err == nil && p.i < len(s) {
+		err = p.errorf("unexpected %q", s[p.i])
+	}
+	if err != nil {
+		return nil, err
+	}
+	if spec.tag == "" {
+		return nil, fmt.Errorf("invalid MARCspec %q: missing field tag", s)
+	}
+	return spec, nil
+}
+
+// ParseMARCSpecs parses a comma-separated list of MARCspecs, as used by the
+// command line tools. Commas inside subspecs, or escaped by a backslash, do
+// not separate specs.
+func ParseMARCSpecs(list string) ([]*MARCSpec, error) {
+	var (
+		res   []*MARCSpec
+		depth int
+		start int
+	)
+	for i := 0; i <= len(list); i++ {
+		if i < len(list) {
+			switch list[i] {
+			case '\\':
+				if i+1 == len(list) {
+					return nil, fmt.Errorf("invalid MARCspec %q: trailing backslash", list[start:])
+				}
+				i++
+				continue
+			case '{':
+				depth++
+				continue
+			case '}':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		spec, err := ParseMARCSpec(list[start:i])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, spec)
+		start = i + 1
+	}
+	return res, nil
+}
+
+// MustParseMARCSpec is like ParseMARCSpec, but panics if the spec cannot be
+// parsed.
+func MustParseMARCSpec(s string) *MARCSpec {
+	spec, err := ParseMARCSpec(s)
+	if err != nil {
+		panic(err)
+	}
+	return spec
+}
+
+// String returns the source text of the spec.
+func (s *MARCSpec) String() string {
+	return s.src
+}
+
+// Values returns the values in r selected by the spec, in record order.
+func (s *MARCSpec) Values(r *Record) []string {
+	var res []string
+	for _, vals := range s.FieldValues(r) {
+		res = append(res, vals...)
+	}
+	return res
+}
+
+// FieldValues returns the values in r selected by the spec, grouped by the
+// field they are from. Fields without selected values are left out.
+func (s *MARCSpec) FieldValues(r *Record) [][]string {
+	var fields []specField
+	if s.tag == "LDR" {
+		fields = append(fields, specField{tag: "LDR", value: r.Leader})
+	} else {
+		for _, f := range r.CtrlFields {
+			if MatchTag(s.tag, f.Tag) {
+				fields = append(fields, specField{tag: f.Tag, value: f.Value})
+			}
+		}
+		for i, f := range r.DataFields {
+			if MatchTag(s.tag, f.Tag) {
+				fields = append(fields, specField{tag: f.Tag, df: &r.DataFields[i]})
+			}
+		}
+	}
+	if s.index != nil {
+		from, to, ok := s.index.resolve(len(fields))
+		if !ok {
+			return nil
+		}
+		fields = fields[from : to+1]
+	}
+
+	var res [][]string
+	for _, f := range fields {
+		if vals := s.fieldValues(r, f); len(vals) > 0 {
+			res = append(res, vals)
+		}
+	}
+	return res
+}
+
+// specField is a field (or the leader) being evaluated.
+type specField struct {
+	tag   string
+	value string  // leader or control field value
+	df    *DField // nil unless data field
+}
+
+// values returns the values of the field as a whole: the value of a control
+// field, or the subfield values of a data field.
+func (f specField) values() []string {
+	if f.df == nil {
+		return []string{f.value}
+	}
+	vals := make([]string, 0, len(f.df.SubFields))
+	for _, sf := range f.df.SubFields {
+		vals = append(vals, sf.Value)
+	}
+	return vals
+}
+
+// fieldValues returns the values selected from field f, disregarding tag and
+// field index.
+func (s *MARCSpec) fieldValues(r *Record, f specField) []string {
+	if !checkSubSpecs(s.subSpecs, r, f, f.values()) {
+		return nil
+	}
+
+	switch {
+	case s.ind > 0:
+		if f.df == nil {
+			return nil
+		}
+		v := f.df.Ind1
+		if s.ind == 2 {
+			v = f.df.Ind2
+		}
+		if !checkSubSpecs(s.indSpecs, r, f, []string{v}) {
+			return nil
+		}
+		return []string{v}
+	case len(s.subfields) > 0:
+		if f.df == nil {
+			return nil
+		}
+		var res []string
+		for _, sfs := range s.subfields {
+			var matching []string
+			for _, sf := range f.df.SubFields {
+				if len(sf.Code) == 1 && sfs.from <= sf.Code[0] && sf.Code[0] <= sfs.to {
+					matching = append(matching, sf.Value)
+				}
+			}
+			if sfs.index != nil {
+				from, to, ok := sfs.index.resolve(len(matching))
+				if !ok {
+					continue
+				}
+				matching = matching[from : to+1]
+			}
+			for _, v := range matching {
+				if !checkSubSpecs(sfs.subSpecs, r, f, []string{v}) {
+					continue
+				}
+				if v, ok := sfs.chars.substr(v); ok {
+					res = append(res, v)
+				}
+			}
+		}
+		return res
+	case f.df != nil:
+		if s.chars != nil {
+			return nil // character positions only apply to control fields
+		}
+		return f.values()
+	default:
+		if v, ok := s.chars.substr(f.value); ok {
+			return []string{v}
+		}
+		return nil
+	}
+}
+
+// resolve returns the range of indexes, counting from 0, selected from n
+// elements.
+func (p *posRange) resolve(n int) (from, to int, ok bool) {
+	from, to = p.from, p.to
+	if from < 0 {
+		from = n - 1
+	}
+	if to < 0 || to >= n {
+		to = n - 1
+	}
+	return from, to, from >= 0 && from < n && from <= to
+}
+
+// substr returns the characters of s in the range. A nil range selects all
+// of s.
+func (p *posRange) substr(s string) (string, bool) {
+	if p == nil {
+		return s, true
+	}
+	n := utf8.RuneCountInString(s)
+	from, to, ok := p.resolve(n)
+	if !ok {
+		return "", false
+	}
+	if n == len(s) {
+		return s[from : to+1], true
+	}
+	runes := []rune(s)
+	return string(runes[from : to+1]), true
+}
+
+func checkSubSpecs(subs []subSpec, r *Record, f specField, cur []string) bool {
+	for _, ss := range subs {
+		ok := false
+		for _, c := range ss {
+			if c.eval(r, f, cur) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c condition) eval(r *Record, f specField, cur []string) bool {
+	right := c.right.values(r, f, cur)
+	switch c.op {
+	case "?":
+		return len(right) > 0
+	case "!":
+		return len(right) == 0
+	}
+
+	left := cur
+	if c.left != nil {
+		left = c.left.values(r, f, cur)
+	}
+	match := func(cmp func(a, b string) bool) bool {
+		for _, a := range left {
+			for _, b := range right {
+				if cmp(a, b) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	equal := func(a, b string) bool { return a == b }
+	switch c.op {
+	case "=":
+		return match(equal)
+	case "!=":
+		return !match(equal)
+	case "~":
+		return match(strings.Contains)
+	default: // "!~"
+		return !match(strings.Contains)
+	}
+}
+
+// values returns the values of the term, evaluated in the context of field
+// f, where cur are the values being tested.
+func (t *specTerm) values(r *Record, f specField, cur []string) []string {
+	switch {
+	case t.spec == nil:
+		return []string{t.str}
+	case t.spec.tag != "":
+		return t.spec.Values(r)
+	case t.spec.ind == 0 && len(t.spec.subfields) == 0 && t.spec.chars != nil:
+		// character positions of the values being tested
+		var res []string
+		for _, v := range cur {
+			if v, ok := t.spec.chars.substr(v); ok {
+				res = append(res, v)
+			}
+		}
+		return res
+	default:
+		return t.spec.fieldValues(r, f)
+	}
+}
+
+type specParser struct {
+	s string
+	i int
+}
+
+func (p *specParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid MARCspec %q: %s at position %d", p.s, fmt.Sprintf(format, args...), p.i)
+}
+
+func (p *specParser) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func isTagChar(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '.'
+}
+
+func isCodeChar(c byte) bool {
+	return c > ' ' && c < 0x7f && !strings.ContainsRune("${}[]/^|\\-", rune(c))
+}
+
+// spec parses a MARCspec, or an abbreviated one without field tag.
+func (p *specParser) spec() (*MARCSpec, error) {
+	start := p.i
+	s := &MARCSpec{}
+	if p.i+3 <= len(p.s) && isTagChar(p.s[p.i]) && isTagChar(p.s[p.i+1]) && isTagChar(p.s[p.i+2]) {
+		s.tag = strings.ReplaceAll(p.s[p.i:p.i+3], ".", "X")
+		p.i += 3
+	} else if c := p.peek(); c != '$' && c != '^' && c != '/' && c != '[' {
+		return nil, p.errorf("expected field tag")
+	}
+
+	var err error
+	if p.peek() == '[' {
+		if s.index, err = p.index(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek() == '/' {
+		if s.chars, err = p.chars(); err != nil {
+			return nil, err
+		}
+	}
+	if s.subSpecs, err = p.subSpecs(); err != nil {
+		return nil, err
+	}
+
+	switch p.peek() {
+	case '^':
+		p.i++
+		switch p.peek() {
+		case '1', '2':
+			s.ind = int(p.peek() - '0')
+			p.i++
+		default:
+			return nil, p.errorf("expected indicator 1 or 2")
+		}
+		if s.indSpecs, err = p.subSpecs(); err != nil {
+			return nil, err
+		}
+	case '$':
+		for p.peek() == '$' {
+			p.i++
+			if !isCodeChar(p.peek()) {
+				return nil, p.errorf("expected subfield code")
+			}
+			sfs := subfieldSpec{from: p.peek(), to: p.peek()}
+			p.i++
+			if p.peek() == '-' {
+				p.i++
+				if !isCodeChar(p.peek()) || p.peek() < sfs.from {
+					return nil, p.errorf("invalid subfield code range")
+				}
+				sfs.to = p.peek()
+				p.i++
+			}
+			if p.peek() == '[' {
+				if sfs.index, err = p.index(); err != nil {
+					return nil, err
+				}
+			}
+			if p.peek() == '/' {
+				if sfs.chars, err = p.chars(); err != nil {
+					return nil, err
+				}
+			}
+			if sfs.subSpecs, err = p.subSpecs(); err != nil {
+				return nil, err
+			}
+			s.subfields = append(s.subfields, sfs)
+		}
+	}
+	if s.tag == "LDR" && (s.ind > 0 || len(s.subfields) > 0) {
+		return nil, p.errorf("leader has no indicators or subfields")
+	}
+	s.src = p.s[start:p.i]
+	return s, nil
+}
+
+func (p *specParser) index() (*posRange, error) {
+	p.i++ // [
+	r, err := p.posRange()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != ']' {
+		return nil, p.errorf("expected ]")
+	}
+	p.i++
+	return r, nil
+}
+
+func (p *specParser) chars() (*posRange, error) {
+	p.i++ // /
+	return p.posRange()
+}
+
+func (p *specParser) posRange() (*posRange, error) {
+	from, err := p.pos()
+	if err != nil {
+		return nil, err
+	}
+	r := &posRange{from: from, to: from}
+	if p.peek() == '-' {
+		p.i++
+		if r.to, err = p.pos(); err != nil {
+			return nil, err
+		}
+		if r.to >= 0 && (r.from < 0 || r.to < r.from) {
+			return nil, p.errorf("invalid range")
+		}
+	}
+	return r, nil
+}
+
+func (p *specParser) pos() (int, error) {
+	if p.peek() == '#' {
+		p.i++
+		return -1, nil
+	}
+	start := p.i
+	for p.i < len(p.s) && '0' <= p.s[p.i] && p.s[p.i] <= '9' {
+		p.i++
+	}
+	if start == p.i {
+		return 0, p.errorf("expected position")
+	}
+	return strconv.Atoi(p.s[start:p.i])
+}
+
+func (p *specParser) subSpecs() ([]subSpec, error) {
+	var res []subSpec
+	for p.peek() == '{' {
+		p.i++
+		var ss subSpec
+		for {
+			c, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+			ss = append(ss, c)
+			if p.peek() == '|' {
+				p.i++
+				continue
+			}
+			if p.peek() != '}' {
+				return nil, p.errorf("expected }")
+			}
+			p.i++
+			break
+		}
+		res = append(res, ss)
+	}
+	return res, nil
+}
+
+func (p *specParser) condition() (condition, error) {
+	var (
+		c   condition
+		err error
+	)
+	rest := p.s[p.i:]
+	switch {
+	case strings.HasPrefix(rest, "!=") || strings.HasPrefix(rest, "!~") ||
+		strings.HasPrefix(rest, "=") || strings.HasPrefix(rest, "~"):
+		// left term left out
+	case strings.HasPrefix(rest, "?") || strings.HasPrefix(rest, "!"):
+		c.op = rest[:1]
+		p.i++
+		c.right, err = p.term(false)
+		return c, err
+	default:
+		if c.left, err = p.term(false); err != nil {
+			return c, err
+		}
+		if p.peek() == '|' || p.peek() == '}' {
+			c.op, c.right, c.left = "?", c.left, nil
+			return c, nil
+		}
+	}
+
+	rest = p.s[p.i:]
+	switch {
+	case strings.HasPrefix(rest, "!="), strings.HasPrefix(rest, "!~"):
+		c.op = rest[:2]
+	case strings.HasPrefix(rest, "="), strings.HasPrefix(rest, "~"):
+		c.op = rest[:1]
+	default:
+		return c, p.errorf("expected operator")
+	}
+	p.i += len(c.op)
+	c.right, err = p.term(true)
+	return c, err
+}
+
+// term parses a subspec term. If lenient, a term which is not a valid
+// MARCspec is taken as a comparison string.
+func (p *specParser) term(lenient bool) (*specTerm, error) {
+	if p.peek() == '\\' {
+		p.i++
+		return &specTerm{str: p.comparisonString()}, nil
+	}
+	start := p.i
+	spec, err := p.spec()
+	if err == nil && (p.peek() == '|' || p.peek() == '}' || !lenient && isOperatorStart(p.peek())) {
+		return &specTerm{spec: spec}, nil
+	}
+	if !lenient {
+		if err == nil {
+			err = p.errorf("unexpected %q", p.peek())
+		}
+		return nil, err
+	}
+	p.i = start
+	return &specTerm{str: p.comparisonString()}, nil
+}
+
+func isOperatorStart(c byte) bool {
+	return c == '=' || c == '~' || c == '!'
+}
+
+// comparisonString reads a string up to an unescaped | or }. A backslash
+// escapes the next character, and \s is a space.
+func (p *specParser) comparisonString() string {
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if c == '|' || c == '}' {
+			break
+		}
+		if c == '\\' && p.i+1 < len(p.s) {
+			p.i++
+			c = p.s[p.i]
+			if c == 's' {
+				c = ' '
+			}
+		}
+		b.WriteByte(c)
+		p.i++
+	}
+	return b.String()
+}
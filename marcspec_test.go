@@ -0,0 +1,131 @@
+package marc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMARCSpec(t *testing.T) {
+	r, err := NewDecoder(bytes.NewBufferString(sampleMARC), MARC).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.DataFields[len(r.DataFields)-1].SubFields = append(r.DataFields[len(r.DataFields)-1].SubFields, SubField{"e", "aut."})
+	r.AddDField(NewDField("650").AddSubField("a", "Numbers").AddSubField("2", "lcsh"))
+	r.AddDField(NewDField("650").AddSubField("a", "Tall").AddSubField("2", "local"))
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"LDR", []string{"01142cam  2200301 a 4500"}},
+		{"LDR/6", []string{"a"}},
+		{"LDR/0-4", []string{"01142"}},
+		{"LDR/#", []string{"0"}},
+		{"008/35-37", []string{"eng"}},
+		{"007/0-1", nil},
+		{"001", []string{"   92005291 "}},
+		{"245$a", []string{"Arithmetic /"}},
+		{"245$c$a", []string{"Carl Sandburg ; illustrated as an anamorphic adventure by Ted Rand.", "Arithmetic /"}},
+		{"260$a-b", []string{"San Diego :", "Harcourt Brace Jovanovich,"}},
+		{"245^1", []string{"1"}},
+		{"245^2", []string{"0"}},
+		{"100", []string{"Sandburg, Carl,", "1878-1967."}},
+		{"650[0]$a", []string{"Arithmetic"}},
+		{"650[#]$a", []string{"Tall"}},
+		{"650[1-2]$a", []string{"Children's poetry, American.", "Arithmetic"}},
+		{"650[9]$a", nil},
+		{"6XX$x", []string{"Juvenile poetry.", "Poetry."}},
+		{"6..$x[0]", []string{"Juvenile poetry.", "Poetry."}},
+		{"700$e[#]", []string{"aut."}},
+		{"245$a/0-3", []string{"Arit"}},
+		{"245$a/#", []string{"/"}},
+		{"6XX$a{$2=\\lcsh}", []string{"Numbers"}},
+		{"6XX$a{$2=lcsh}", []string{"Numbers"}},
+		{"6XX$a{$2=\\lcsh|$2=\\local}", []string{"Numbers", "Tall"}},
+		{"650$a{$2!=\\lcsh}", []string{"Arithmetic", "Children's poetry, American.", "Arithmetic", "American poetry.", "Visual perception.", "Tall"}},
+		{"650$a{?$x}", []string{"Arithmetic", "Arithmetic"}},
+		{"650$a{$x}", []string{"Arithmetic", "Arithmetic"}},
+		{"650$a{!$x}{!$2}", []string{"Children's poetry, American.", "American poetry.", "Visual perception."}},
+		{"650$a{~\\poetry}", []string{"Children's poetry, American.", "American poetry."}},
+		{"650$a{!~\\a}", []string{"Arithmetic", "Arithmetic", "Numbers"}},
+		{"650$a{/0=\\A}", []string{"Arithmetic", "Arithmetic", "American poetry."}},
+		{"650{^2=\\1}$a", []string{"Arithmetic", "American poetry.", "Visual perception."}},
+		{"650{$x~\\Poetry}{^2=\\1}$a", []string{"Arithmetic"}},
+		{"245$a{008/35-37=\\eng}", []string{"Arithmetic /"}},
+		{"245$a{LDR/6=\\x}", nil},
+		{"245$a{=\\Arithmetic\\s/}", []string{"Arithmetic /"}},
+		{"999$a", nil},
+	}
+	for _, test := range tests {
+		spec, err := ParseMARCSpec(test.spec)
+		if err != nil {
+			t.Errorf("ParseMARCSpec(%q) => %v", test.spec, err)
+			continue
+		}
+		if got := spec.Values(r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s => %q; want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestMARCSpecFieldValues(t *testing.T) {
+	r := NewRecord()
+	r.DataFields = DFields{
+		NewDField("655").AddSubField("a", "Fiction").AddSubField("x", "History"),
+		NewDField("655").AddSubField("a", "Poetry"),
+	}
+	got := MustParseMARCSpec("655$a$x").FieldValues(r)
+	want := [][]string{{"Fiction", "History"}, {"Poetry"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FieldValues => %q; want %q", got, want)
+	}
+}
+
+func TestParseMARCSpecErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"24",
+		"$a",
+		"245$",
+		"245^3",
+		"245[",
+		"245[a]",
+		"245[3-1]",
+		"245/",
+		"LDR$a",
+		"245$a{",
+		"245$a{$2=\\x",
+		"245$a{$2 \\x}",
+		"245$a}",
+		"245$c-a",
+	} {
+		if _, err := ParseMARCSpec(s); err == nil {
+			t.Errorf("ParseMARCSpec(%q) => no error", s)
+		}
+	}
+}
+
+func TestParseMARCSpecs(t *testing.T) {
+	specs, err := ParseMARCSpecs(`245$a,650$a{$2=\lcsh|$x~\a\,b},LDR/6`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range specs {
+		got = append(got, s.String())
+	}
+	want := []string{`245$a`, `650$a{$2=\lcsh|$x~\a\,b}`, `LDR/6`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseMARCSpecs => %q; want %q", got, want)
+	}
+	if _, err := ParseMARCSpecs("245$a,,100"); err == nil {
+		t.Error("ParseMARCSpecs with empty spec => no error")
+	}
+	for _, list := range []string{`245$a,650$a\`, `650$a{$2=\`} {
+		if specs, err := ParseMARCSpecs(list); err == nil {
+			t.Errorf("ParseMARCSpecs(%q) => %d specs; want trailing backslash error", list, len(specs))
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package marc
+
+import (
+	"io"
+	"os"
+)
+
+func mmap(f *os.File, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func munmap(b []byte) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package marc
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrConflict is returned when a patch does not apply to a record, because
+// a field it removes or changes is not in the record.
+var ErrConflict = errors.New("patch conflict")
+
+// Patch is the changes to a record, as returned by Diff, together with the
+// key identifying the record. Patches serialize to JSON, one per line in a
+// patch file.
+type Patch struct {
+	KeyTag  string        `json:"keyTag"` // ex. "001"
+	Key     string        `json:"key"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Key returns the value identifying r by the given tag: the value of the
+// control field, or of subfield $a of the first data field with that tag.
+// The empty string is returned if r has no such field.
+func (r *Record) Key(tag string) string {
+	if f, ok := r.GetCField(tag); ok {
+		return f.Value
+	}
+	for _, f := range r.DataFields {
+		if f.Tag == tag {
+			return f.SubField("a")
+		}
+	}
+	return ""
+}
+
+// Apply applies changes, as returned by Diff, to r. Removed and changed
+// fields are located by their old value, disregarding subfield order. Added
+// fields are appended to the record.
+//
+// If any of the fields to remove or change is not found, r is left unchanged
+// and an error wrapping ErrConflict is returned. A leader change applies if
+// the leaders differ at most in record length and base address of data,
+// which are set by the encoder anyway.
+func (r *Record) Apply(changes []FieldChange) error {
+	ctrl := slices.Clone(r.CtrlFields)
+	data := slices.Clone(r.DataFields)
+	leader := r.Leader
+
+	// Fields changed or added are not matched by later changes.
+	ctrlDone := make([]bool, len(ctrl))
+	dataDone := make([]bool, len(data))
+
+	for _, c := range changes {
+		switch {
+		case c.Tag == "LDR":
+			if c.OldCField == nil || c.NewCField == nil {
+				return fmt.Errorf("%w: leader can only be changed", ErrConflict)
+			}
+			if !sameLeader(leader, c.OldCField.Value) {
+				return fmt.Errorf("%w: leader is %q; want %q", ErrConflict, leader, c.OldCField.Value)
+			}
+			leader = c.NewCField.Value
+		case c.OldCField != nil || c.NewCField != nil:
+			i := -1
+			if c.OldCField != nil {
+				for j, f := range ctrl {
+					if !ctrlDone[j] && f == *c.OldCField {
+						i = j
+						break
+					}
+				}
+				if i < 0 {
+					return fmt.Errorf("%w: %s %s not found", ErrConflict, c.Tag, c.OldCField.Value)
+				}
+			}
+			switch {
+			case c.NewCField == nil:
+				ctrl = slices.Delete(ctrl, i, i+1)
+				ctrlDone = slices.Delete(ctrlDone, i, i+1)
+			case i >= 0:
+				ctrl[i], ctrlDone[i] = *c.NewCField, true
+			default:
+				ctrl, ctrlDone = append(ctrl, *c.NewCField), append(ctrlDone, true)
+			}
+		default:
+			i := -1
+			if c.OldDField != nil {
+				for j, f := range data {
+					if !dataDone[j] && equalDField(f, *c.OldDField) {
+						i = j
+						break
+					}
+				}
+				if i < 0 {
+					return fmt.Errorf("%w: %s field not found", ErrConflict, c.Tag)
+				}
+			}
+			switch {
+			case c.NewDField == nil && i >= 0:
+				data = slices.Delete(data, i, i+1)
+				dataDone = slices.Delete(dataDone, i, i+1)
+			case c.NewDField == nil:
+				return fmt.Errorf("%w: %s change without fields", ErrConflict, c.Tag)
+			case i >= 0:
+				data[i], dataDone[i] = cloneDField(*c.NewDField), true
+			default:
+				data, dataDone = append(data, cloneDField(*c.NewDField)), append(dataDone, true)
+			}
+		}
+	}
+
+	r.Leader, r.CtrlFields, r.DataFields = leader, ctrl, data
+	return nil
+}
+
+// sameLeader tests if leaders a and b are equal, disregarding record length
+// (positions 0-4) and base address of data (12-16).
+func sameLeader(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) != 24 || len(b) != 24 {
+		return false
+	}
+	return a[5:12] == b[5:12] && a[17:] == b[17:]
+}
+
+func cloneDField(f DField) DField {
+	f.SubFields = slices.Clone(f.SubFields)
+	return f
+}
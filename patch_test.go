@@ -0,0 +1,92 @@
+package marc
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func patchTestRecords() (a, b *Record) {
+	a = NewRecord()
+	a.Leader = "00100cam  2200049 a 4500"
+	a.CtrlFields = CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: "20200101"}}
+	a.DataFields = DFields{
+		NewDField("020").AddSubField("a", "111"),
+		NewDField("245").AddSubField("a", "Title").AddSubField("c", "Doe"),
+		NewDField("650").AddSubField("a", "Cats"),
+		NewDField("650").AddSubField("a", "Dogs"),
+	}
+
+	b = NewRecord()
+	b.Leader = "00000nam  2200000 a 4500"
+	b.CtrlFields = CFields{{Tag: "001", Value: "1"}, {Tag: "005", Value: "20210101"}, {Tag: "008", Value: "x"}}
+	b.DataFields = DFields{
+		NewDField("245").AddSubField("a", "New title").AddSubField("c", "Doe"),
+		NewDField("500").AddSubField("a", "Note"),
+		NewDField("650").AddSubField("a", "Dogs"),
+	}
+	return a, b
+}
+
+func TestApply(t *testing.T) {
+	a, b := patchTestRecords()
+	changes := Diff(a, b)
+
+	// Another copy of a, with fields in different order and a leader
+	// differing only in record length.
+	c := NewRecord()
+	c.Leader = "00123cam  2200049 a 4500"
+	c.CtrlFields = CFields{a.CtrlFields[1], a.CtrlFields[0]}
+	c.DataFields = DFields{a.DataFields[3], a.DataFields[2], a.DataFields[1], a.DataFields[0]}
+
+	for _, r := range []*Record{a, c} {
+		if err := r.Apply(changes); err != nil {
+			t.Fatal(err)
+		}
+		if !r.Equal(b, EqualOptions{Leader: true}) {
+			t.Errorf("Apply(Diff(a, b)) =>\n%s\nwant:\n%s", dumpString(r), dumpString(b))
+		}
+	}
+
+	// a conflicting change leaves the record unchanged
+	d, _ := patchTestRecords()
+	d.DataFields[1].SubFields[0].Value = "Local title"
+	before := dumpString(d)
+	if err := d.Apply(changes); !errors.Is(err, ErrConflict) {
+		t.Errorf("Apply with conflict => %v; want ErrConflict", err)
+	}
+	if after := dumpString(d); after != before {
+		t.Errorf("Apply with conflict modified record:\n%s\nwant:\n%s", after, before)
+	}
+}
+
+func TestPatchJSON(t *testing.T) {
+	a, b := patchTestRecords()
+	p := Patch{KeyTag: "001", Key: a.Key("001"), Changes: Diff(a, b)}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Patch
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("Patch JSON round trip =>\n%+v\nwant:\n%+v", got, p)
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	a, _ := patchTestRecords()
+	tests := []struct{ tag, want string }{
+		{"001", "1"},
+		{"650", "Cats"},
+		{"100", ""},
+	}
+	for _, test := range tests {
+		if got := a.Key(test.tag); got != test.want {
+			t.Errorf("Key(%q) => %q; want %q", test.tag, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package marc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// Pipeline decodes and transforms records on multiple goroutines, handing
+// the results on in input order.
+//
+// When reading from a binary MARC Decoder, the input stream is split into raw
+// record frames on the record terminator, and the frames are decoded by the
+// workers. Records from other sources are read sequentially, but still
+// transformed in parallel.
+type Pipeline struct {
+	// Workers is the number of goroutines decoding and transforming
+	// records. Defaults to runtime.GOMAXPROCS(0).
+	Workers int
+
+	// InFlight is the maximum number of records being processed at once.
+	// When the sink falls behind, reading blocks until it catches up.
+	// Defaults to 4 * Workers.
+	InFlight int
+
+	// Transform, if set, is applied to every succesfully decoded record.
+	// Returning a nil record and nil error drops the record.
+	Transform func(*Record) (*Record, error)
+}
+
+type pipelineJob struct {
+	seq   int
+	frame []byte // raw binary MARC record
+	rec   *Record
+	err   error
+	fatal bool // error reading input; ends the pipeline
+}
+
+// Run reads records from src until the end of records, and calls sink with
+// each record, or the error decoding or transforming it, in input order.
+// Sink is never called concurrently. If sink returns an error, or ctx is
+// cancelled, the pipeline stops and Run returns that error. Any error from
+// src other than a RecordError, such as an error reading the underlying
+// input, also stops the pipeline, after it has been passed to sink.
+func (p Pipeline) Run(ctx context.Context, src RecordReader, sink func(*Record, error) error) error {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	inFlight := p.InFlight
+	if inFlight <= 0 {
+		inFlight = 4 * workers
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dec, frames := src.(*Decoder)
+	frames = frames && dec.f == MARC
+
+	var (
+		jobs    = make(chan *pipelineJob, inFlight)
+		results = make(chan *pipelineJob, inFlight)
+		tokens  = make(chan struct{}, inFlight) // limits records in flight
+	)
+
+	// reader
+	go func() {
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			select {
+			case tokens <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			j := &pipelineJob{seq: seq}
+			if frames {
+				b, err := dec.readMARC()
+				if err == io.EOF {
+					return
+				}
+				j.frame, j.err, j.fatal = bytes.Clone(b), err, err != nil
+			} else {
+				j.rec, j.err = src.Decode()
+				if j.err == io.EOF {
+					return
+				}
+				j.fatal = fatal(j.err)
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return
+			}
+			if j.fatal {
+				return
+			}
+		}
+	}()
+
+	// workers
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var dir []dirEntry
+			for j := range jobs {
+				if j.frame != nil {
+					j.rec = NewRecord()
+					dir, j.err = dec.decodeMARCFrame(j.frame, j.rec, dir[:0])
+					j.frame = nil
+				}
+				if j.err != nil {
+					j.rec = nil
+				} else if p.Transform != nil {
+					j.rec, j.err = p.Transform(j.rec)
+				}
+				select {
+				case results <- j:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Hand results on in order. Out-of-order results wait in pending,
+	// which is bounded by the number of records in flight.
+	var (
+		pending = make(map[int]*pipelineJob, inFlight)
+		next    = 0
+		err     error
+	)
+	for j := range results {
+		pending[j.seq] = j
+		for err == nil {
+			j, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			<-tokens
+			if j.rec == nil && j.err == nil {
+				continue // dropped by transform
+			}
+			if err = sink(j.rec, j.err); err == nil && j.fatal {
+				err = j.err
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		// Stop the reader and workers, and wait for them to finish.
+		cancel()
+		for range results {
+		}
+		return err
+	}
+	return ctx.Err()
+}
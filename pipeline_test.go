@@ -0,0 +1,202 @@
+package marc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numberedRecords returns n records with 001 set to their ordinal,
+// encoded in format f.
+func numberedRecords(t testing.TB, n int, f Format) []byte {
+	var b bytes.Buffer
+	enc := NewEncoder(&b, f)
+	for i := 0; i < n; i++ {
+		r := NewRecord()
+		r.Leader = string(leaderTemplate)
+		r.CtrlFields = CFields{{Tag: "001", Value: strconv.Itoa(i)}}
+		r.AddDField(NewDField("245").AddSubField("a", strings.Repeat("x", i%50)))
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func recordID(r *Record) int {
+	f, _ := r.GetCField("001")
+	n, _ := strconv.Atoi(f.Value)
+	return n
+}
+
+func TestPipelineOrder(t *testing.T) {
+	for _, f := range []Format{MARC, LineMARC} {
+		input := numberedRecords(t, 1000, f)
+		p := Pipeline{Workers: 8, InFlight: 16}
+		next := 0
+		err := p.Run(context.Background(), NewDecoder(bytes.NewReader(input), f), func(r *Record, err error) error {
+			if err != nil {
+				return err
+			}
+			if id := recordID(r); id != next {
+				return fmt.Errorf("got record %d; want %d", id, next)
+			}
+			next++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if next != 1000 {
+			t.Errorf("%v: got %d records; want 1000", f, next)
+		}
+	}
+}
+
+func TestPipelineTransform(t *testing.T) {
+	input := numberedRecords(t, 100, MARC)
+	errOdd := errors.New("odd")
+	p := Pipeline{
+		Workers: 4,
+		Transform: func(r *Record) (*Record, error) {
+			switch id := recordID(r); {
+			case id%10 == 0:
+				return nil, nil // drop
+			case id%10 == 5:
+				return nil, errOdd
+			default:
+				r.AddDField(NewDField("999").AddSubField("a", "seen"))
+				return r, nil
+			}
+		},
+	}
+	var recs, errs int
+	err := p.Run(context.Background(), NewDecoder(bytes.NewReader(input), MARC), func(r *Record, err error) error {
+		if err != nil {
+			if err != errOdd {
+				return err
+			}
+			errs++
+			return nil
+		}
+		if len(r.GetDFields("999")) != 1 {
+			return fmt.Errorf("record %d not transformed", recordID(r))
+		}
+		recs++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs != 80 || errs != 10 {
+		t.Errorf("got %d records, %d errors; want 80 records, 10 errors", recs, errs)
+	}
+}
+
+func TestPipelineDecodeErrors(t *testing.T) {
+	input := sampleMARC + "00010" + sampleMARC[5:] + sampleMARC
+	var recs, errs int
+	err := Pipeline{Workers: 2}.Run(context.Background(), NewDecoder(strings.NewReader(input), MARC), func(r *Record, err error) error {
+		if err != nil {
+			if r != nil {
+				t.Error("got non-nil record together with error")
+			}
+			errs++
+			return nil
+		}
+		recs++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs != 2 || errs != 1 {
+		t.Errorf("got %d records, %d errors; want 2 records, 1 error", recs, errs)
+	}
+}
+
+func TestPipelineReaderError(t *testing.T) {
+	errRead := errors.New("read error")
+	var n, calls int
+	src := ReaderFunc(func() (*Record, error) {
+		if calls++; calls > 100 {
+			return nil, io.EOF // Run does not stop on errRead
+		}
+		switch calls {
+		case 1, 3:
+			return NewRecord(), nil
+		case 2:
+			return nil, &RecordError{errors.New("bad record")}
+		}
+		return nil, errRead
+	})
+	err := Pipeline{Workers: 2}.Run(context.Background(), src, func(r *Record, err error) error {
+		n++
+		return nil
+	})
+	if err != errRead {
+		t.Errorf("Run => %v; want %v", err, errRead)
+	}
+	if n != 4 {
+		t.Errorf("sink called %d times; want 4", n)
+	}
+}
+
+func TestPipelineSinkError(t *testing.T) {
+	input := numberedRecords(t, 1000, MARC)
+	errStop := errors.New("stop")
+	n := 0
+	err := Pipeline{Workers: 4}.Run(context.Background(), NewDecoder(bytes.NewReader(input), MARC), func(r *Record, err error) error {
+		n++
+		if n == 10 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("Run => %v; want %v", err, errStop)
+	}
+	if n != 10 {
+		t.Errorf("sink called %d times after returning error; want 10", n)
+	}
+}
+
+func TestPipelineCancel(t *testing.T) {
+	input := numberedRecords(t, 1000, MARC)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n := 0
+	err := Pipeline{Workers: 4}.Run(ctx, NewDecoder(bytes.NewReader(input), MARC), func(r *Record, err error) error {
+		n++
+		if n == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Run => %v; want %v", err, context.Canceled)
+	}
+	if n >= 1000 {
+		t.Error("pipeline not stopped by cancel")
+	}
+}
+
+func BenchmarkPipelineDecodeMARC(b *testing.B) {
+	input := strings.Repeat(sampleMARC, b.N)
+	b.SetBytes(int64(len(sampleMARC)))
+	b.ResetTimer()
+	err := Pipeline{}.Run(context.Background(), NewDecoder(strings.NewReader(input), MARC), func(r *Record, err error) error {
+		return err
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
@@ -0,0 +1,219 @@
+package marc
+
+import (
+	"math"
+	"slices"
+)
+
+// ScoreFunc scores an aspect of a record, from 0 (worst) to 1 (best). It
+// returns false if the aspect does not apply to the record, ex. authority
+// links in a record without headings.
+type ScoreFunc func(r *Record) (score float64, ok bool)
+
+// QualityCriterion is a named, weighted criterion of record quality.
+type QualityCriterion struct {
+	Name   string
+	Weight float64
+	Score  ScoreFunc
+}
+
+// DefaultQualityCriteria returns the default criteria: core fields,
+// encoding level, authority links, validity of 008 and subject vocabularies.
+func DefaultQualityCriteria() []QualityCriterion {
+	return []QualityCriterion{
+		{"core", 3, CoreFieldsScore("020", "100", "245", "260-264", "300", "6XX")},
+		{"encoding", 2, EncodingLevelScore},
+		{"links", 1, AuthorityLinkScore},
+		{"008", 1, FixedFieldScore},
+		{"subjects", 1, SubjectVocabularyScore()},
+	}
+}
+
+// QualityScore is the quality of a record.
+type QualityScore struct {
+	Total  float64   // weighted mean of the applicable criteria, from 0 to 100
+	Scores []float64 // score of each criterion, NaN if not applicable
+}
+
+// ScoreQuality scores r by the given criteria. Criteria not applicable to r
+// are left out of the weighted mean.
+func ScoreQuality(r *Record, criteria []QualityCriterion) QualityScore {
+	qs := QualityScore{Scores: make([]float64, len(criteria))}
+	var sum, weights float64
+	for i, c := range criteria {
+		s, ok := c.Score(r)
+		if !ok {
+			qs.Scores[i] = math.NaN()
+			continue
+		}
+		qs.Scores[i] = s
+		sum += c.Weight * s
+		weights += c.Weight
+	}
+	if weights > 0 {
+		qs.Total = 100 * sum / weights
+	}
+	return qs
+}
+
+// QualitySummary sums up the quality of the records of a file.
+type QualitySummary struct {
+	Records   int
+	Histogram [10]int // records by total score, in buckets of 10; 100 goes in the last
+
+	total  float64
+	sums   []float64
+	counts []int
+}
+
+// Add adds the score of a record to the summary.
+func (s *QualitySummary) Add(qs QualityScore) {
+	s.Records++
+	s.total += qs.Total
+	s.Histogram[min(int(qs.Total/10), 9)]++
+	for len(s.sums) < len(qs.Scores) {
+		s.sums = append(s.sums, 0)
+		s.counts = append(s.counts, 0)
+	}
+	for i, v := range qs.Scores {
+		if !math.IsNaN(v) {
+			s.sums[i] += v
+			s.counts[i]++
+		}
+	}
+}
+
+// Mean returns the mean total score.
+func (s *QualitySummary) Mean() float64 {
+	if s.Records == 0 {
+		return 0
+	}
+	return s.total / float64(s.Records)
+}
+
+// CriterionMean returns the mean score of criterion i, over the records it
+// applies to, and the number of those records.
+func (s *QualitySummary) CriterionMean(i int) (float64, int) {
+	if i >= len(s.counts) || s.counts[i] == 0 {
+		return math.NaN(), 0
+	}
+	return s.sums[i] / float64(s.counts[i]), s.counts[i]
+}
+
+// CoreFieldsScore returns a ScoreFunc giving the fraction of tag patterns
+// (see MatchTag) matched by at least one field of a record. A range such as
+// "260-264" counts as one.
+func CoreFieldsScore(patterns ...string) ScoreFunc {
+	return func(r *Record) (float64, bool) {
+		if len(patterns) == 0 {
+			return 0, false
+		}
+		n := 0
+		for _, p := range patterns {
+			if len(r.MatchCFields(p)) > 0 || len(r.IndexDFields(p)) > 0 {
+				n++
+			}
+		}
+		return float64(n) / float64(len(patterns)), true
+	}
+}
+
+// encodingLevels scores the MARC 21 encoding levels (leader/17), and the
+// OCLC levels I, K and M.
+var encodingLevels = map[byte]float64{
+	' ': 1, 'I': 1,
+	'1': 0.9,
+	'4': 0.8,
+	'2': 0.6, 'K': 0.6,
+	'7': 0.5, 'M': 0.5,
+	'5': 0.4,
+	'3': 0.3,
+	'8': 0.2,
+}
+
+// EncodingLevelScore scores the encoding level (leader/17) of a record, from
+// full (1) to prepublication (0.2). Unknown levels score 0.
+func EncodingLevelScore(r *Record) (float64, bool) {
+	if len(r.Leader) < 18 {
+		return 0, true
+	}
+	return encodingLevels[r.Leader[17]], true
+}
+
+// headingTags are the tags of fields with controlled headings.
+var headingTags = []string{
+	"100", "110", "111", "130",
+	"600", "610", "611", "630", "648", "650", "651", "655",
+	"700", "710", "711", "730",
+	"800", "810", "811", "830",
+}
+
+// AuthorityLinkScore gives the fraction of controlled headings in a record
+// linked to an authority record by $0. It does not apply to records without
+// headings.
+func AuthorityLinkScore(r *Record) (float64, bool) {
+	headings, linked := 0, 0
+	for _, f := range r.DataFields {
+		if !slices.Contains(headingTags, f.Tag) {
+			continue
+		}
+		headings++
+		if f.SubField("0") != "" {
+			linked++
+		}
+	}
+	if headings == 0 {
+		return 0, false
+	}
+	return float64(linked) / float64(headings), true
+}
+
+// FixedFieldScore gives the fraction of valid positions of 008 (see
+// FixedValues). A record without 008, or with a 008 of the wrong length,
+// scores 0.
+func FixedFieldScore(r *Record) (float64, bool) {
+	if f, ok := r.GetCField("008"); !ok || len(f.Value) != 40 {
+		return 0, true
+	}
+	n, valid := 0, 0
+	for _, v := range r.FixedValues() {
+		if v.Tag != "008" {
+			continue
+		}
+		n++
+		if v.Valid() {
+			valid++
+		}
+	}
+	return float64(valid) / float64(n), true
+}
+
+// SubjectVocabularyScore returns a ScoreFunc giving the fraction of subject
+// fields (600-662) of a record from a known vocabulary: a thesaurus given by
+// the second indicator (0-3, 5 or 6), or by $2 when it is 7. If vocabularies
+// are given, $2 must be one of them. It does not apply to records without
+// subjects.
+func SubjectVocabularyScore(vocabularies ...string) ScoreFunc {
+	return func(r *Record) (float64, bool) {
+		subjects, known := 0, 0
+		for _, f := range r.DataFields {
+			if !MatchTag("600-662", f.Tag) {
+				continue
+			}
+			subjects++
+			switch f.Ind2 {
+			case "0", "1", "2", "3", "5", "6":
+				known++
+			case "7":
+				src := f.SubField("2")
+				if src != "" && (len(vocabularies) == 0 || slices.Contains(vocabularies, src)) {
+					known++
+				}
+			}
+		}
+		if subjects == 0 {
+			return 0, false
+		}
+		return float64(known) / float64(subjects), true
+	}
+}
@@ -0,0 +1,64 @@
+package marc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreQuality(t *testing.T) {
+	r := NewRecord()
+	r.Leader = "00100cam a2200049 a 4500"
+	r.CtrlFields = CFields{
+		{Tag: "001", Value: "1"},
+		{Tag: "008", Value: "200101s2020    no a   x      000 1 nob d"}, // 22 invalid
+	}
+	r.DataFields = DFields{
+		NewDField("100").AddSubField("a", "Doe, Jane").AddSubField("0", "(NO-TrBIB)1"),
+		NewDField("245").AddSubField("a", "Title"),
+		NewDField("264").AddSubField("c", "2020"),
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: SubFields{{Code: "a", Value: "Cats"}}},
+		{Tag: "650", Ind1: " ", Ind2: "7", SubFields: SubFields{{Code: "a", Value: "Katter"}, {Code: "2", Value: "local"}}},
+	}
+
+	criteria := []QualityCriterion{
+		{"core", 3, CoreFieldsScore("020", "100", "245", "260-264", "300", "6XX")},
+		{"encoding", 2, EncodingLevelScore},
+		{"links", 1, AuthorityLinkScore},
+		{"008", 1, FixedFieldScore},
+		{"subjects", 1, SubjectVocabularyScore("lcsh")},
+		{"none", 1, func(*Record) (float64, bool) { return 0, false }},
+	}
+	want := []float64{4.0 / 6, 1, 1.0 / 3, 18.0 / 19, 0.5, math.NaN()}
+
+	qs := ScoreQuality(r, criteria)
+	for i, w := range want {
+		got := qs.Scores[i]
+		if math.IsNaN(w) != math.IsNaN(got) || !math.IsNaN(w) && math.Abs(got-w) > 1e-9 {
+			t.Errorf("score of %s => %v; want %v", criteria[i].Name, got, w)
+		}
+	}
+	wantTotal := 100 * (3*4.0/6 + 2 + 1.0/3 + 18.0/19 + 0.5) / 8
+	if math.Abs(qs.Total-wantTotal) > 1e-9 {
+		t.Errorf("total score => %v; want %v", qs.Total, wantTotal)
+	}
+}
+
+func TestQualitySummary(t *testing.T) {
+	var s QualitySummary
+	s.Add(QualityScore{Total: 100, Scores: []float64{1, math.NaN()}})
+	s.Add(QualityScore{Total: 45, Scores: []float64{0.5, 0.4}})
+	s.Add(QualityScore{Total: 0, Scores: []float64{0, math.NaN()}})
+
+	if s.Records != 3 {
+		t.Errorf("Records => %d; want 3", s.Records)
+	}
+	if got, want := s.Mean(), 145.0/3; got != want {
+		t.Errorf("Mean() => %v; want %v", got, want)
+	}
+	if s.Histogram != [10]int{1, 0, 0, 0, 1, 0, 0, 0, 0, 1} {
+		t.Errorf("Histogram => %v", s.Histogram)
+	}
+	if m, n := s.CriterionMean(1); m != 0.4 || n != 1 {
+		t.Errorf("CriterionMean(1) => %v, %d; want 0.4, 1", m, n)
+	}
+}
@@ -0,0 +1,371 @@
+package marc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Query is a boolean expression over the values selected by MARCspecs, used
+// to filter records. The conditions are:
+//
+//	245$a              exists: the spec selects a value
+//	041$a = nob        equal
+//	041$a != nob       not equal
+//	245$a ~ "Poetry"   contains
+//	245$a !~ Poetry    does not contain
+//	245$a =~ /^The /   matches regular expression
+//	008/7-10 >= 2000   numeric comparison: <, <=, >, >=
+//
+// A condition holds if any value selected by the spec satisfies it, except
+// for != and !~, which hold if none of the values are equal or contained.
+// Prefixed by ALL, a comparison holds if every value satisfies it, or if
+// there are no values, as in ALL 856$u =~ /^https:/.
+// Values are quoted with double or single quotes, or between slashes for
+// regular expressions, if they contain spaces or parentheses. Conditions
+// are combined with AND, OR and NOT (or &&, || and !), and grouped with
+// parentheses. AND binds tighter than OR.
+//
+//	041$a ~ nob AND LDR/6 = a
+//	NOT 650 OR (008/7-10 < 1900 && !245$b)
+type Query struct {
+	src  string
+	root queryNode
+}
+
+type queryNode interface {
+	match(r *Record) bool
+}
+
+type (
+	andNode []queryNode
+	orNode  []queryNode
+	notNode struct{ n queryNode }
+)
+
+func (n andNode) match(r *Record) bool {
+	for _, c := range n {
+		if !c.match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n orNode) match(r *Record) bool {
+	for _, c := range n {
+		if c.match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n notNode) match(r *Record) bool {
+	return !n.n.match(r)
+}
+
+type condNode struct {
+	all   bool
+	spec  *MARCSpec
+	op    string // empty for exists
+	value string
+	re    *regexp.Regexp // for =~
+	num   float64        // for numeric comparisons
+}
+
+func (n *condNode) match(r *Record) bool {
+	vals := n.spec.Values(r)
+	if n.all {
+		for _, v := range vals {
+			if !n.matchValue(v) {
+				return false
+			}
+		}
+		return true
+	}
+	switch n.op {
+	case "":
+		return len(vals) > 0
+	case "!=":
+		for _, v := range vals {
+			if v == n.value {
+				return false
+			}
+		}
+		return true
+	case "!~":
+		for _, v := range vals {
+			if strings.Contains(v, n.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range vals {
+		if n.matchValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *condNode) matchValue(v string) bool {
+	switch n.op {
+	case "=":
+		return v == n.value
+	case "!=":
+		return v != n.value
+	case "!~":
+		return !strings.Contains(v, n.value)
+	case "~":
+		return strings.Contains(v, n.value)
+	case "=~":
+		return n.re.MatchString(v)
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return false
+	}
+	switch n.op {
+	case "<":
+		return f < n.num
+	case "<=":
+		return f <= n.num
+	case ">":
+		return f > n.num
+	default: // ">="
+		return f >= n.num
+	}
+}
+
+// ParseQuery parses a query.
+func ParseQuery(s string) (*Query, error) {
+	p := &queryParser{s: s}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.i < len(s) {
+		return nil, p.errorf("unexpected %q", s[p.i:])
+	}
+	return &Query{src: s, root: root}, nil
+}
+
+// MustParseQuery is like ParseQuery, but panics if the query cannot be
+// parsed.
+func MustParseQuery(s string) *Query {
+	q, err := ParseQuery(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source text of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Match reports whether r satisfies the query.
+func (q *Query) Match(r *Record) bool {
+	return q.root.match(r)
+}
+
+type queryParser struct {
+	s string
+	i int
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid query %q: %s at position %d", p.s, fmt.Sprintf(format, args...), p.i)
+}
+
+func (p *queryParser) skipSpace() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t' || p.s[p.i] == '\n') {
+		p.i++
+	}
+}
+
+// keyword consumes one of the given keywords, ignoring case for words.
+func (p *queryParser) keyword(kws ...string) bool {
+	p.skipSpace()
+	for _, kw := range kws {
+		end := p.i + len(kw)
+		if end > len(p.s) || !strings.EqualFold(p.s[p.i:end], kw) {
+			continue
+		}
+		if isWordByte(kw[0]) && end < len(p.s) && isWordByte(p.s[end]) {
+			continue // prefix of a longer word, ex. a spec
+		}
+		p.i = end
+		return true
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+func (p *queryParser) or() (queryNode, error) {
+	var nodes orNode
+	for {
+		n, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		if !p.keyword("OR", "||") {
+			break
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) and() (queryNode, error) {
+	var nodes andNode
+	for {
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+		if !p.keyword("AND", "&&") {
+			break
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) not() (queryNode, error) {
+	p.skipSpace()
+	rest := p.s[p.i:]
+	neg := strings.HasPrefix(rest, "!") && !strings.HasPrefix(rest, "!=") && !strings.HasPrefix(rest, "!~")
+	if neg {
+		p.i++
+	}
+	if neg || p.keyword("NOT") {
+		n, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	}
+	if p.keyword("(") {
+		n, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, p.errorf("expected )")
+		}
+		return n, nil
+	}
+	return p.cond()
+}
+
+var queryOps = []string{"!=", "!~", "=~", "<=", ">=", "=", "~", "<", ">"}
+
+func (p *queryParser) cond() (queryNode, error) {
+	all := p.keyword("ALL")
+	p.skipSpace()
+	start := p.i
+	depth := 0
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if depth == 0 && strings.IndexByte(" \t\n()=!<>~&|", c) >= 0 {
+			break
+		}
+		switch c {
+		case '\\':
+			if p.i+1 == len(p.s) {
+				return nil, p.errorf("trailing backslash")
+			}
+			p.i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		}
+		p.i++
+	}
+	if start == p.i {
+		return nil, p.errorf("expected MARCspec")
+	}
+	spec, err := ParseMARCSpec(p.s[start:p.i])
+	if err != nil {
+		return nil, err
+	}
+	n := &condNode{all: all, spec: spec}
+
+	p.skipSpace()
+	for _, op := range queryOps {
+		if strings.HasPrefix(p.s[p.i:], op) {
+			n.op = op
+			p.i += len(op)
+			break
+		}
+	}
+	if n.op == "" {
+		if all {
+			return nil, p.errorf("ALL needs a comparison")
+		}
+		return n, nil
+	}
+
+	p.skipSpace()
+	if n.value, err = p.value(); err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "=~":
+		if n.re, err = regexp.Compile(n.value); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	case "<", "<=", ">", ">=":
+		if n.num, err = strconv.ParseFloat(n.value, 64); err != nil {
+			return nil, p.errorf("%q not a number", n.value)
+		}
+	}
+	return n, nil
+}
+
+// value parses a quoted, slash-delimited or bare value.
+func (p *queryParser) value() (string, error) {
+	if p.i >= len(p.s) {
+		return "", p.errorf("expected value")
+	}
+	switch q := p.s[p.i]; q {
+	case '"', '\'', '/':
+		var b strings.Builder
+		for p.i++; p.i < len(p.s); p.i++ {
+			c := p.s[p.i]
+			if c == q {
+				p.i++
+				return b.String(), nil
+			}
+			if c == '\\' && p.i+1 < len(p.s) && p.s[p.i+1] == q {
+				p.i++
+				c = q
+			}
+			b.WriteByte(c)
+		}
+		return "", p.errorf("unterminated value")
+	}
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(" \t\n()", p.s[p.i]) < 0 {
+		p.i++
+	}
+	if start == p.i {
+		return "", p.errorf("expected value")
+	}
+	return p.s[start:p.i], nil
+}
@@ -0,0 +1,117 @@
+package marc
+
+import (
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	r := NewRecord()
+	r.Leader = "00000cam  2200000 a 4500"
+	r.CtrlFields = CFields{
+		{Tag: "001", Value: "42"},
+		{Tag: "008", Value: "871001s1987    no            000 0 nob  "},
+	}
+	r.DataFields = DFields{
+		NewDField("041").AddSubField("a", "nobeng"),
+		NewDField("245").AddSubField("a", "The title (a story)").AddSubField("c", "Doe"),
+		NewDField("650").AddSubField("a", "Cats").AddSubField("2", "lcsh"),
+		NewDField("650").AddSubField("a", "Katter"),
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"245$a", true},
+		{"245$b", false},
+		{"!245$b", true},
+		{"NOT 245$b", true},
+		{"not 245$a", false},
+		{"LDR/6 = a", true},
+		{"LDR/6 = t", false},
+		{"LDR/6 != t", true},
+		{"041$a ~ nob", true},
+		{"041$a ~ swe", false},
+		{"041$a !~ swe", true},
+		{"041$a ~ nob AND LDR/6 = a", true},
+		{"041$a ~ nob AND LDR/6 = t", false},
+		{"041$a ~ swe OR LDR/6 = a", true},
+		{"041$a ~ swe || LDR/6 = t", false},
+		{"041$a ~ nob && !(LDR/6 = t || 245$b)", true},
+		{"245$a = \"The title (a story)\"", true},
+		{"245$a = 'The title'", false},
+		{"245$a ~ 'title (a'", true},
+		{"245$a =~ /^The .*\\)$/", true},
+		{"245$a =~ /^A /", false},
+		{"650$a = Katter", true},
+		{"650$a != Katter", false},
+		{"650$a{$2=\\lcsh} = Katter", false},
+		{"650$a{$2=\\lcsh} = Cats", true},
+		{"008/7-10 >= 1987", true},
+		{"008/7-10 > 1987", false},
+		{"008/7-10 < 2000 AND 008/7-10 <= 1987", true},
+		{"001 > 41.5", true},
+		{"245$a > 1", false}, // not a number
+		{"LDR/6 = a AND 041$a ~ swe OR 001 = 42", true},
+		{"LDR/6 = a AND (041$a ~ swe OR 001 = 43)", false},
+		{"ALL 650$a = Katter", false},
+		{"ALL 650$a =~ /^[CK]at/", true},
+		{"ALL 650$a != Hunder", true},
+		{"ALL 856$u =~ /^https:/", true}, // no values
+		{"all 041$a ~ nob AND NOT ALL 650$2 = fast", true},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) => %v", test.query, err)
+			continue
+		}
+		if got := q.Match(r); got != test.want {
+			t.Errorf("%s => %v; want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"245$a =",
+		"245$a = 'x",
+		"(245$a",
+		"245$a)",
+		"245$a AND",
+		"NOT",
+		"ALL 245$a",
+		"245$ = x",
+		"008/7-10 > x",
+		"245$a =~ /(/",
+		"245$a 100$a",
+		"245$a\\",
+	} {
+		if _, err := ParseQuery(s); err == nil {
+			t.Errorf("ParseQuery(%q) => no error", s)
+		}
+	}
+}
+
+func FuzzParseQuery(f *testing.F) {
+	for _, s := range []string{
+		`245$a = "Title"`,
+		`NOT (650$a ~ cats OR 650$2 != lcsh)`,
+		`ALL 020$a =~ /^97[89]/ AND 008/35-37 = nor`,
+		`650$a{$2=\lcsh} = x`,
+		`245$a\`,
+	} {
+		f.Add(s)
+	}
+	r := NewRecord()
+	r.Leader = "00000cam  2200000 a 4500"
+	r.AddDField(NewDField("245").AddSubField("a", "Title"))
+	f.Fuzz(func(t *testing.T, s string) {
+		q, err := ParseQuery(s)
+		if err != nil {
+			return
+		}
+		q.Match(r)
+	})
+}
@@ -0,0 +1,195 @@
+package marc
+
+import (
+	"fmt"
+	"io"
+	"iter"
+)
+
+// RecordReader is the interface implemented by sources of records, such as
+// Decoder. Decode returns io.EOF when there are no more records. An error in
+// a single record is returned as a *RecordError, after which reading can go
+// on; any other error ends the records.
+type RecordReader interface {
+	Decode() (*Record, error)
+}
+
+// RecordWriter is the interface implemented by sinks of records, such as
+// Encoder.
+type RecordWriter interface {
+	Encode(*Record) error
+}
+
+// ReaderFunc adapts an ordinary function to a RecordReader, ex. to read
+// records from a database cursor.
+type ReaderFunc func() (*Record, error)
+
+// Decode calls f().
+func (f ReaderFunc) Decode() (*Record, error) { return f() }
+
+// WriterFunc adapts an ordinary function to a RecordWriter.
+type WriterFunc func(*Record) error
+
+// Encode calls f(r).
+func (f WriterFunc) Encode(r *Record) error { return f(r) }
+
+// All returns an iterator over the records of r. Errors are yielded together
+// with a nil record, and any error other than a RecordError ends the
+// iteration, like Decoder.All.
+func All(r RecordReader) iter.Seq2[*Record, error] {
+	return func(yield func(*Record, error) bool) {
+		for {
+			rec, err := r.Decode()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				rec = nil
+			}
+			if !yield(rec, err) || fatal(err) {
+				return
+			}
+		}
+	}
+}
+
+// Copy writes all records from r to w, until the end of records or an
+// error. It returns the number of records written, and the first error
+// encountered, if any.
+func Copy(w RecordWriter, r RecordReader) (int, error) {
+	n := 0
+	for {
+		rec, err := r.Decode()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := w.Encode(rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Filter returns a RecordReader with only the records of r for which keep
+// returns true. Errors are passed through.
+func Filter(r RecordReader, keep func(*Record) bool) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		for {
+			rec, err := r.Decode()
+			if err != nil || keep(rec) {
+				return rec, err
+			}
+		}
+	})
+}
+
+// Map returns a RecordReader with the records of r transformed by fn.
+// Errors from r are passed through without calling fn.
+func Map(r RecordReader, fn func(*Record) (*Record, error)) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		rec, err := r.Decode()
+		if err != nil {
+			return rec, err
+		}
+		return fn(rec)
+	})
+}
+
+// Tee returns a RecordReader which writes each record read from r to w.
+// An error writing to w is returned from Decode, together with the record.
+func Tee(r RecordReader, w RecordWriter) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		rec, err := r.Decode()
+		if err != nil {
+			return rec, err
+		}
+		return rec, w.Encode(rec)
+	})
+}
+
+// Limit returns a RecordReader which reads at most n records from r, and
+// then returns io.EOF. Errors do not count towards the limit.
+func Limit(r RecordReader, n int) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		if n <= 0 {
+			return nil, io.EOF
+		}
+		rec, err := r.Decode()
+		if err == nil {
+			n--
+		}
+		return rec, err
+	})
+}
+
+// Skip returns a RecordReader which discards the first n records of r.
+// Errors while skipping are passed through; after an error other than a
+// RecordError, skipping stops.
+func Skip(r RecordReader, n int) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		for ; n > 0; n-- {
+			if _, err := r.Decode(); err != nil {
+				if fatal(err) {
+					n = 0
+				}
+				return nil, err
+			}
+		}
+		return r.Decode()
+	})
+}
+
+// Concat returns a RecordReader which reads the records of each of rs in
+// turn.
+func Concat(rs ...RecordReader) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		for len(rs) > 0 {
+			rec, err := rs[0].Decode()
+			if err != io.EOF {
+				return rec, err
+			}
+			rs = rs[1:]
+		}
+		return nil, io.EOF
+	})
+}
+
+// Batch returns an iterator over the records of r in batches of up to n
+// records, where n must be at least 1. A decoding error is yielded with the
+// records of the batch read until then. Reading continues with a new batch
+// after a RecordError; any other error ends the iteration.
+func Batch(r RecordReader, n int) iter.Seq2[[]*Record, error] {
+	return func(yield func([]*Record, error) bool) {
+		if n < 1 {
+			yield(nil, fmt.Errorf("invalid batch size: %d", n))
+			return
+		}
+		batch := make([]*Record, 0, n)
+		for {
+			rec, err := r.Decode()
+			if err == io.EOF {
+				if len(batch) > 0 {
+					yield(batch, nil)
+				}
+				return
+			}
+			if err != nil {
+				if !yield(batch, err) || fatal(err) {
+					return
+				}
+				batch = make([]*Record, 0, n)
+				continue
+			}
+			batch = append(batch, rec)
+			if len(batch) == n {
+				if !yield(batch, nil) {
+					return
+				}
+				batch = make([]*Record, 0, n)
+			}
+		}
+	}
+}
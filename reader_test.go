@@ -0,0 +1,189 @@
+package marc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+var (
+	_ RecordReader = (*Decoder)(nil)
+	_ RecordReader = (*MappedDecoder)(nil)
+	_ RecordWriter = (*Encoder)(nil)
+)
+
+// sliceReader returns a RecordReader over records numbered from to to,
+// with an error in place of any ordinal in errAt.
+func sliceReader(from, to int, errAt ...int) RecordReader {
+	i := from
+	return ReaderFunc(func() (*Record, error) {
+		if i >= to {
+			return nil, io.EOF
+		}
+		defer func() { i++ }()
+		for _, e := range errAt {
+			if e == i {
+				return nil, &RecordError{errors.New("bad record")}
+			}
+		}
+		r := NewRecord()
+		r.CtrlFields = CFields{{Tag: "001", Value: string(rune('0' + i))}}
+		return r, nil
+	})
+}
+
+var errRead = errors.New("read error")
+
+// brokenReader returns a RecordReader over records numbered from 0 to n,
+// and then errRead on every call, like a decoder of a truncated stream.
+func brokenReader(n int) RecordReader {
+	return ReaderFunc(func() (*Record, error) {
+		if n--; n < 0 {
+			return nil, errRead
+		}
+		r := NewRecord()
+		r.CtrlFields = CFields{{Tag: "001", Value: string(rune('0' + n))}}
+		return r, nil
+	})
+}
+
+// ids reads r to the end, and returns the ids of the records, with -1 in
+// place of errors.
+func ids(r RecordReader) []int {
+	res := []int{}
+	for rec, err := range All(r) {
+		if err != nil {
+			res = append(res, -1)
+			continue
+		}
+		res = append(res, recordID(rec))
+	}
+	return res
+}
+
+func TestCombinators(t *testing.T) {
+	even := func(r *Record) bool { return recordID(r)%2 == 0 }
+	tests := []struct {
+		name string
+		r    RecordReader
+		want []int
+	}{
+		{"Filter", Filter(sliceReader(0, 6), even), []int{0, 2, 4}},
+		{"Filter errors", Filter(sliceReader(0, 6, 3), even), []int{0, 2, -1, 4}},
+		{"Map", Map(sliceReader(0, 3), func(r *Record) (*Record, error) {
+			r.CtrlFields[0].Value = string(r.CtrlFields[0].Value[0] + 1)
+			return r, nil
+		}), []int{1, 2, 3}},
+		{"Limit", Limit(sliceReader(0, 6), 2), []int{0, 1}},
+		{"Limit errors", Limit(sliceReader(0, 6, 1), 2), []int{0, -1, 2}},
+		{"Limit 0", Limit(sliceReader(0, 6), 0), []int{}},
+		{"Skip", Skip(sliceReader(0, 6), 4), []int{4, 5}},
+		{"Skip all", Skip(sliceReader(0, 3), 5), []int{}},
+		{"Concat", Concat(sliceReader(0, 2), sliceReader(5, 5), sliceReader(7, 9)), []int{0, 1, 7, 8}},
+		{"Concat none", Concat(), []int{}},
+		{"Limit(Skip)", Limit(Skip(sliceReader(0, 9), 3), 3), []int{3, 4, 5}},
+		{"All read error", brokenReader(2), []int{1, 0, -1}},
+		{"Skip read error", Skip(brokenReader(2), 5), []int{-1}},
+		{"Filter read error", Filter(brokenReader(2), even), []int{0, -1}},
+	}
+
+	for _, test := range tests {
+		if got := ids(test.r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s => %v; want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	var teed []int
+	w := WriterFunc(func(r *Record) error {
+		teed = append(teed, recordID(r))
+		return nil
+	})
+	if got := ids(Tee(sliceReader(0, 3), w)); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("Tee => %v; want [0 1 2]", got)
+	}
+	if !reflect.DeepEqual(teed, []int{0, 1, 2}) {
+		t.Errorf("Tee wrote %v; want [0 1 2]", teed)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	var b bytes.Buffer
+	enc := NewEncoder(&b, MARC)
+	n, err := Copy(enc, NewDecoder(bytes.NewReader(numberedRecords(t, 10, MARC)), MARC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.Flush()
+	if n != 10 {
+		t.Errorf("Copy => %d records; want 10", n)
+	}
+	if got := ids(NewDecoder(&b, MARC)); !reflect.DeepEqual(got, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("copied records => %v", got)
+	}
+
+	n, err = Copy(WriterFunc(func(*Record) error { return nil }), sliceReader(0, 5, 3))
+	if n != 3 || err == nil {
+		t.Errorf("Copy => %d, %v; want 3, error", n, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var got [][]int
+	for batch, err := range Batch(sliceReader(0, 8, 5), 3) {
+		ids := []int{}
+		for _, r := range batch {
+			ids = append(ids, recordID(r))
+		}
+		if err != nil {
+			ids = append(ids, -1)
+		}
+		got = append(got, ids)
+	}
+	want := [][]int{{0, 1, 2}, {3, 4, -1}, {6, 7}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Batch => %v; want %v", got, want)
+	}
+
+	n := 0
+	for _, err := range Batch(brokenReader(4), 3) {
+		if n++; n > 10 {
+			t.Fatal("Batch does not stop on read error")
+		}
+		if err != nil && err != errRead {
+			t.Errorf("Batch => %v; want %v", err, errRead)
+		}
+	}
+	if n != 2 {
+		t.Errorf("Batch over broken reader => %d batches; want 2", n)
+	}
+
+	for _, size := range []int{0, -1} {
+		for batch, err := range Batch(sliceReader(0, 3), size) {
+			if batch != nil || err == nil {
+				t.Errorf("Batch(%d) => %v, %v; want error", size, batch, err)
+			}
+		}
+	}
+}
+
+func TestPipelineRecordReader(t *testing.T) {
+	var got []int
+	err := Pipeline{Workers: 3}.Run(context.Background(), Skip(sliceReader(0, 8), 2), func(r *Record, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, recordID(r))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pipeline over RecordReader => %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package spec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+// Rule is a local cataloguing rule, checked with queries (see marc.Query).
+// A record breaks the rule if it matches the When conditions, and one of the
+// Require queries does not match, or one of the Forbid queries matches.
+type Rule struct {
+	Name     string
+	Severity Severity
+	Message  string        // optional; describes the broken query if empty
+	When     []*marc.Query // conditions for the rule to apply, all of which must match
+	Require  []*marc.Query
+	Forbid   []*marc.Query
+}
+
+// Check returns the violations of the rule in r, one for each broken
+// Require or Forbid query.
+func (rule *Rule) Check(r *marc.Record) []ValidationIssue {
+	for _, q := range rule.When {
+		if !q.Match(r) {
+			return nil
+		}
+	}
+	var issues []ValidationIssue
+	add := func(verb string, q *marc.Query) {
+		msg := rule.Message
+		if msg == "" {
+			msg = verb + " " + q.String()
+		}
+		issues = append(issues, ValidationIssue{
+			Severity: rule.Severity,
+			Kind:     RuleViolation,
+			Rule:     rule.Name,
+			Message:  msg,
+		})
+	}
+	for _, q := range rule.Require {
+		if !q.Match(r) {
+			add("require", q)
+		}
+	}
+	for _, q := range rule.Forbid {
+		if q.Match(r) {
+			add("forbid", q)
+		}
+	}
+	return issues
+}
+
+// Rules is a set of rules. Check may be called concurrently.
+type Rules []*Rule
+
+// Check returns the violations of the rules in r, in the order of the rules.
+func (rs Rules) Check(r *marc.Record) []ValidationIssue {
+	var issues []ValidationIssue
+	for _, rule := range rs {
+		issues = append(issues, rule.Check(r)...)
+	}
+	return issues
+}
+
+// ParseRules reads rules in a line-based format. A rule starts with its
+// name, followed by directives, one per line:
+//
+//	# Comment
+//	rule media-for-text
+//	  when     336$a = text
+//	  require  337$a = unmediated OR 337$a = computer
+//	  message  Text must be unmediated or computer
+//
+//	rule https
+//	  require  ALL 856$u =~ /^https:/
+//	  severity warning
+//
+//	rule subject-source
+//	  forbid   650{^2=7}{!$2}
+//
+// The directives when, require and forbid take a query, and can be
+// repeated. The severity is error or warning; it defaults to error.
+func ParseRules(r io.Reader) (Rules, error) {
+	var (
+		rules Rules
+		rule  *Rule
+		names = make(map[string]bool)
+	)
+	end := func() error {
+		if rule != nil && len(rule.Require) == 0 && len(rule.Forbid) == 0 {
+			return fmt.Errorf("rule %s has no require or forbid", rule.Name)
+		}
+		return nil
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		directive, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		if directive == "rule" {
+			if err := end(); err != nil {
+				return nil, err
+			}
+			if arg == "" || strings.ContainsAny(arg, " \t") {
+				return nil, fmt.Errorf("line %d: invalid rule name %q", n, arg)
+			}
+			if names[arg] {
+				return nil, fmt.Errorf("line %d: duplicate rule %s", n, arg)
+			}
+			names[arg] = true
+			rule = &Rule{Name: arg, Severity: Error}
+			rules = append(rules, rule)
+			continue
+		}
+		if rule == nil {
+			return nil, fmt.Errorf("line %d: %s outside of a rule", n, directive)
+		}
+		var err error
+		switch directive {
+		case "when":
+			rule.When, err = appendQuery(rule.When, arg)
+		case "require":
+			rule.Require, err = appendQuery(rule.Require, arg)
+		case "forbid":
+			rule.Forbid, err = appendQuery(rule.Forbid, arg)
+		case "message":
+			rule.Message = arg
+		case "severity":
+			err = rule.Severity.UnmarshalText([]byte(arg))
+		default:
+			err = fmt.Errorf("unknown directive %q", directive)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := end(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// LoadRules reads rules from the named file; see ParseRules.
+func LoadRules(name string) (Rules, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rules, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return rules, nil
+}
+
+func appendQuery(qs []*marc.Query, s string) ([]*marc.Query, error) {
+	q, err := marc.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	return append(qs, q), nil
+}
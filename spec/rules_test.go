@@ -0,0 +1,93 @@
+package spec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/boutros/marc"
+)
+
+const testRules = `# Local rules
+rule media-for-text
+  when     336$a = text
+  require  337$a = unmediated OR 337$a = computer
+  message  Text must be unmediated or computer
+
+rule https
+  require  ALL 856$u =~ /^https:/
+  severity warning
+
+rule subject-source
+  forbid   650{^2=7}{!$2}
+`
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("ParseRules => %d rules; want 3", len(rules))
+	}
+
+	subject := func(ind2 string, sfs ...string) marc.DField {
+		f := marc.DField{Tag: "650", Ind1: " ", Ind2: ind2}
+		for i := 0; i < len(sfs); i += 2 {
+			f = f.AddSubField(sfs[i], sfs[i+1])
+		}
+		return f
+	}
+	r := marc.NewRecord()
+	r.DataFields = marc.DFields{
+		marc.NewDField("336").AddSubField("a", "text"),
+		marc.NewDField("337").AddSubField("a", "audio"),
+		subject("7", "a", "Katter", "2", "noubomn"),
+		subject("7", "a", "Hunder"),
+		subject("0", "a", "Dogs"),
+		marc.NewDField("856").AddSubField("u", "https://example.org/1"),
+		marc.NewDField("856").AddSubField("u", "http://example.org/2"),
+	}
+	var got []string
+	for _, issue := range rules.Check(r) {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		"error rule media-for-text: Text must be unmediated or computer",
+		"warning rule https: require ALL 856$u =~ /^https:/",
+		"error rule subject-source: forbid 650{^2=7}{!$2}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check =>\n%q\nwant:\n%q", got, want)
+	}
+
+	r.DataFields = marc.DFields{
+		marc.NewDField("336").AddSubField("a", "text"),
+		marc.NewDField("337").AddSubField("a", "unmediated"),
+		subject("7", "a", "Katter", "2", "noubomn"),
+	}
+	if issues := rules.Check(r); len(issues) != 0 {
+		t.Errorf("Check => %v; want no issues", issues)
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	tests := []struct {
+		rules string
+		want  string
+	}{
+		{"require 245", "line 1: require outside of a rule"},
+		{"rule a\nrequire 245\nrule a\nforbid 246", "line 3: duplicate rule a"},
+		{"rule a b\nrequire 245", `line 1: invalid rule name "a b"`},
+		{"rule a\nwhen 245", "rule a has no require or forbid"},
+		{"rule a\nrequire 245\nseverity fatal", `line 3: unknown severity: "fatal"`},
+		{"rule a\nrequire 245\nunless 246", `line 3: unknown directive "unless"`},
+		{"rule a\n\n# query\nrequire 245$a =", "line 4: "},
+	}
+	for _, tt := range tests {
+		_, err := ParseRules(strings.NewReader(tt.rules))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("ParseRules(%q) => %v; want %q", tt.rules, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Package spec provides definitions of MARC fields: their names,
+// repeatability, valid indicator values and subfields. The MARC 21 Format for
+// Bibliographic Data is embedded, and can be extended with national formats,
+// such as NORMARC, and local fields from a file.
+package spec
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+)
+
+//go:embed marc21.json
+var marc21JSON []byte
+
+// SubField defines a subfield.
+type SubField struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Repeatable bool   `json:"repeatable"`
+	Obsolete   bool   `json:"obsolete,omitempty"`
+}
+
+// Field defines a control field or data field.
+type Field struct {
+	Tag        string
+	Name       string
+	Repeatable bool
+	Obsolete   bool
+
+	// Ind1 and Ind2 map the valid values of the indicators, with blank as
+	// " ", to their meaning. They are nil for undefined indicators, which
+	// must be blank. The value "*" means that any value is valid, ex. in
+	// 880, where the indicators are those of the associated field.
+	Ind1, Ind2 map[string]string
+
+	SubFields []SubField // in the order of the documentation
+
+	// set records whether repeatable and obsolete were given, for merging
+	// extensions.
+	repeatableSet, obsoleteSet bool
+}
+
+// IsControl reports whether the field is a control field (00X), without
+// indicators and subfields.
+func (f *Field) IsControl() bool {
+	return len(f.Tag) == 3 && f.Tag[:2] == "00"
+}
+
+// SubField returns the definition of the subfield with the given code.
+func (f *Field) SubField(code string) (SubField, bool) {
+	for _, sf := range f.SubFields {
+		if sf.Code == code {
+			return sf, true
+		}
+	}
+	return SubField{}, false
+}
+
+// ValidInd1 reports whether v is a valid first indicator. An empty
+// indicator is taken as blank.
+func (f *Field) ValidInd1(v string) bool {
+	return validIndicator(f.Ind1, v)
+}
+
+// ValidInd2 reports whether v is a valid second indicator. An empty
+// indicator is taken as blank.
+func (f *Field) ValidInd2(v string) bool {
+	return validIndicator(f.Ind2, v)
+}
+
+func validIndicator(values map[string]string, v string) bool {
+	if v == "" {
+		v = " "
+	}
+	if values == nil {
+		return v == " "
+	}
+	if _, ok := values["*"]; ok {
+		return len(v) == 1
+	}
+	_, ok := values[v]
+	return ok
+}
+
+// Dictionary is a set of field definitions.
+type Dictionary struct {
+	Name   string
+	fields map[string]*Field
+}
+
+var (
+	marc21     *Dictionary
+	marc21Once sync.Once
+)
+
+// MARC21 returns the embedded MARC 21 Format for Bibliographic Data. The
+// dictionary is shared, and must not be modified; use Extend to add fields.
+func MARC21() *Dictionary {
+	marc21Once.Do(func() {
+		d, err := parse(marc21JSON)
+		if err != nil {
+			panic("spec: embedded MARC 21 dictionary: " + err.Error())
+		}
+		marc21 = d
+	})
+	return marc21
+}
+
+// fileField is the representation of a field in a dictionary file.
+type fileField struct {
+	Tag        string            `json:"tag"`
+	Name       string            `json:"name"`
+	Repeatable *bool             `json:"repeatable"`
+	Obsolete   *bool             `json:"obsolete"`
+	Ind1       map[string]string `json:"ind1"`
+	Ind2       map[string]string `json:"ind2"`
+	SubFields  []SubField        `json:"subfields"`
+}
+
+// Load reads a dictionary in the JSON format of the embedded MARC 21
+// dictionary:
+//
+//	{
+//	  "name": "Local fields",
+//	  "fields": [
+//	    {
+//	      "tag": "950",
+//	      "name": "Local Subject",
+//	      "repeatable": true,
+//	      "ind1": {" ": "No information provided"},
+//	      "subfields": [
+//	        {"code": "a", "name": "Subject", "repeatable": false}
+//	      ]
+//	    }
+//	  ]
+//	}
+//
+// Omitted indicators are undefined. A dictionary with changes to existing
+// fields can omit what is unchanged, and be applied with Extend.
+func Load(r io.Reader) (*Dictionary, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return parse(b)
+}
+
+// LoadFile reads a dictionary from the named file; see Load.
+func LoadFile(name string) (*Dictionary, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, err := Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return d, nil
+}
+
+func parse(b []byte) (*Dictionary, error) {
+	var file struct {
+		Name   string      `json:"name"`
+		Fields []fileField `json:"fields"`
+	}
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, err
+	}
+	d := &Dictionary{Name: file.Name, fields: make(map[string]*Field, len(file.Fields))}
+	for _, ff := range file.Fields {
+		if len(ff.Tag) != 3 {
+			return nil, fmt.Errorf("invalid tag %q", ff.Tag)
+		}
+		if _, ok := d.fields[ff.Tag]; ok {
+			return nil, fmt.Errorf("field %s defined twice", ff.Tag)
+		}
+		f := &Field{
+			Tag:       ff.Tag,
+			Name:      ff.Name,
+			Ind1:      ff.Ind1,
+			Ind2:      ff.Ind2,
+			SubFields: ff.SubFields,
+		}
+		if ff.Repeatable != nil {
+			f.Repeatable, f.repeatableSet = *ff.Repeatable, true
+		}
+		if ff.Obsolete != nil {
+			f.Obsolete, f.obsoleteSet = *ff.Obsolete, true
+		}
+		for _, sf := range f.SubFields {
+			if len(sf.Code) != 1 {
+				return nil, fmt.Errorf("field %s: invalid subfield code %q", f.Tag, sf.Code)
+			}
+		}
+		d.fields[f.Tag] = f
+	}
+	return d, nil
+}
+
+// Field returns the definition of the field with the given tag.
+func (d *Dictionary) Field(tag string) (*Field, bool) {
+	f, ok := d.fields[tag]
+	return f, ok
+}
+
+// SubField returns the definition of a subfield of the field with the given
+// tag.
+func (d *Dictionary) SubField(tag, code string) (SubField, bool) {
+	f, ok := d.fields[tag]
+	if !ok {
+		return SubField{}, false
+	}
+	return f.SubField(code)
+}
+
+// Tags returns the tags of the defined fields, in order.
+func (d *Dictionary) Tags() []string {
+	tags := slices.Collect(maps.Keys(d.fields))
+	sort.Strings(tags)
+	return tags
+}
+
+// Extend returns a new dictionary with the fields of ext added to those of
+// d. Fields defined in both are merged: the name, repeatability and obsolete
+// marker given by ext replace those of d, and the indicator values and
+// subfields of ext are added, replacing those with the same value or code.
+// Neither d nor ext is modified.
+func (d *Dictionary) Extend(ext *Dictionary) *Dictionary {
+	res := &Dictionary{Name: d.Name, fields: make(map[string]*Field, len(d.fields)+len(ext.fields))}
+	if ext.Name != "" {
+		res.Name = d.Name + " + " + ext.Name
+	}
+	for tag, f := range d.fields {
+		res.fields[tag] = f
+	}
+	for tag, e := range ext.fields {
+		f, ok := res.fields[tag]
+		if !ok {
+			res.fields[tag] = e
+			continue
+		}
+		m := *f
+		if e.Name != "" {
+			m.Name = e.Name
+		}
+		if e.repeatableSet {
+			m.Repeatable, m.repeatableSet = e.Repeatable, true
+		}
+		if e.obsoleteSet {
+			m.Obsolete, m.obsoleteSet = e.Obsolete, true
+		}
+		m.Ind1 = mergeIndicator(f.Ind1, e.Ind1)
+		m.Ind2 = mergeIndicator(f.Ind2, e.Ind2)
+		m.SubFields = slices.Clone(f.SubFields)
+		for _, sf := range e.SubFields {
+			i := slices.IndexFunc(m.SubFields, func(s SubField) bool { return s.Code == sf.Code })
+			if i >= 0 {
+				m.SubFields[i] = sf
+			} else {
+				m.SubFields = append(m.SubFields, sf)
+			}
+		}
+		res.fields[tag] = &m
+	}
+	return res
+}
+
+func mergeIndicator(a, b map[string]string) map[string]string {
+	if b == nil {
+		return a
+	}
+	res := maps.Clone(a)
+	if res == nil {
+		res = make(map[string]string, len(b))
+	}
+	maps.Copy(res, b)
+	return res
+}
@@ -0,0 +1,178 @@
+package spec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMARC21(t *testing.T) {
+	d := MARC21()
+
+	f, ok := d.Field("245")
+	if !ok {
+		t.Fatal("245 not defined")
+	}
+	if f.Name != "Title Statement" || f.Repeatable || f.Obsolete || f.IsControl() {
+		t.Errorf("245 => %+v", f)
+	}
+	for _, tt := range []struct {
+		ind1, ind2 string
+		want       bool
+	}{
+		{"1", "0", true},
+		{"0", "4", true},
+		{"2", "0", false},
+		{"1", " ", false},
+	} {
+		if got := f.ValidInd1(tt.ind1) && f.ValidInd2(tt.ind2); got != tt.want {
+			t.Errorf("245 indicators %q %q valid => %v; want %v", tt.ind1, tt.ind2, got, tt.want)
+		}
+	}
+
+	sf, ok := d.SubField("245", "c")
+	if !ok || sf.Name != "Statement of responsibility, etc." || sf.Repeatable {
+		t.Errorf("245$c => %+v, %v", sf, ok)
+	}
+	if _, ok := d.SubField("245", "x"); ok {
+		t.Error("245$x defined")
+	}
+
+	if f, ok := d.Field("001"); !ok || !f.IsControl() {
+		t.Errorf("001 => %+v, %v", f, ok)
+	}
+	if f, ok := d.Field("440"); !ok || !f.Obsolete {
+		t.Errorf("440 => %+v, %v; want obsolete", f, ok)
+	}
+	if f, _ := d.Field("500"); !f.ValidInd1("") || !f.ValidInd2(" ") || f.ValidInd1("1") {
+		t.Error("500 should only allow blank indicators")
+	}
+	if f, _ := d.Field("880"); !f.ValidInd1("1") || !f.ValidInd2(" ") {
+		t.Error("880 should allow any indicators")
+	}
+	if _, ok := d.Field("950"); ok {
+		t.Error("950 defined")
+	}
+}
+
+func TestMARC21Core(t *testing.T) {
+	d := MARC21()
+	// Fields of current cataloguing practice (RDA), which records are
+	// checked against.
+	core := []string{
+		"018", "020", "023", "024", "040", "041", "043", "050", "082", "100", "110", "245", "246", "250", "264",
+		"300", "334", "335", "336", "337", "338", "340", "341", "344", "345", "346", "347", "348",
+		"351", "353", "361", "370", "377", "380", "381", "382", "383", "384", "385", "386", "387", "388",
+		"490", "500", "504", "505", "520", "532", "543", "546", "588", "600", "650", "655", "688", "700",
+		"758", "776", "830", "856", "880", "881",
+	}
+	for _, tag := range core {
+		f, ok := d.Field(tag)
+		if !ok {
+			t.Errorf("%s not defined", tag)
+			continue
+		}
+		if f.Name == "" || f.Obsolete || len(f.SubFields) == 0 {
+			t.Errorf("%s => %+v", tag, f)
+		}
+		if _, ok := f.SubField("6"); !ok {
+			t.Errorf("%s$6 not defined", tag)
+		}
+	}
+
+	// Linking entry fields, as in analytic records with 773 and 774.
+	for _, tag := range []string{
+		"760", "762", "765", "767", "770", "772", "773", "774", "775", "776", "777",
+		"780", "785", "786", "787", "788",
+	} {
+		f, ok := d.Field(tag)
+		if !ok {
+			t.Errorf("%s not defined", tag)
+			continue
+		}
+		if !f.Repeatable || !f.ValidInd1("0") || !f.ValidInd1("1") || f.ValidInd1(" ") {
+			t.Errorf("%s => %+v", tag, f)
+		}
+		for _, code := range []string{"a", "t", "w", "6", "7"} {
+			if _, ok := f.SubField(code); !ok {
+				t.Errorf("%s$%s not defined", tag, code)
+			}
+		}
+	}
+
+	if f, _ := d.Field("382"); !f.ValidInd1("2") || !f.ValidInd2("1") || f.ValidInd2("2") {
+		t.Errorf("382 indicators => %v %v", f.Ind1, f.Ind2)
+	}
+	if sf, ok := d.SubField("758", "4"); !ok || !sf.Repeatable {
+		t.Errorf("758$4 => %+v, %v", sf, ok)
+	}
+}
+
+const localFields = `{
+  "name": "Local",
+  "fields": [
+    {
+      "tag": "245",
+      "subfields": [
+        {"code": "c", "name": "Responsibility", "repeatable": true},
+        {"code": "w", "name": "Local sort title", "repeatable": false}
+      ]
+    },
+    {
+      "tag": "950",
+      "name": "Local Subject",
+      "repeatable": true,
+      "ind2": {" ": "No information provided", "1": "Primary"},
+      "subfields": [{"code": "a", "name": "Subject", "repeatable": false}]
+    }
+  ]
+}`
+
+func TestExtend(t *testing.T) {
+	ext, err := Load(strings.NewReader(localFields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := MARC21().Extend(ext)
+
+	if d.Name != "MARC 21 Bibliographic + Local" {
+		t.Errorf("Name => %q", d.Name)
+	}
+	f, ok := d.Field("245")
+	if !ok || f.Name != "Title Statement" || f.Repeatable || !f.ValidInd1("1") {
+		t.Errorf("merged 245 => %+v, %v", f, ok)
+	}
+	if sf, _ := f.SubField("c"); !sf.Repeatable {
+		t.Error("245$c not replaced")
+	}
+	if _, ok := f.SubField("w"); !ok {
+		t.Error("245$w not added")
+	}
+	if _, ok := f.SubField("a"); !ok {
+		t.Error("245$a lost")
+	}
+	if sf, _ := MARC21().SubField("245", "c"); sf.Repeatable {
+		t.Error("MARC21 modified by Extend")
+	}
+
+	f, ok = d.Field("950")
+	if !ok || !f.Repeatable || !f.ValidInd2("1") || f.ValidInd1("1") {
+		t.Errorf("950 => %+v, %v", f, ok)
+	}
+	if got := d.Tags(); !reflect.DeepEqual(got[len(got)-1:], []string{"950"}) {
+		t.Errorf("Tags() ends with %v; want 950", got[len(got)-1:])
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, s := range []string{
+		`{"fields": [{"tag": "24"}]}`,
+		`{"fields": [{"tag": "245"}, {"tag": "245"}]}`,
+		`{"fields": [{"tag": "245", "subfields": [{"code": "ab"}]}]}`,
+		`{"fields": `,
+	} {
+		if _, err := Load(strings.NewReader(s)); err == nil {
+			t.Errorf("Load(%s) => no error", s)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package spec
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/boutros/marc"
+)
+
+// Severity is the severity of a validation issue.
+type Severity int
+
+// Severities, from least to most severe.
+const (
+	Warning Severity = iota + 1
+	Error
+)
+
+// String returns a string representation of a Severity.
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface.
+func (s Severity) MarshalText() ([]byte, error) {
+	if s < Warning || s > Error {
+		return nil, fmt.Errorf("unknown severity: %d", s)
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface.
+func (s *Severity) UnmarshalText(b []byte) error {
+	for v := Warning; v <= Error; v++ {
+		if string(b) == v.String() {
+			*s = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity: %q", b)
+}
+
+// Kinds of validation issues.
+const (
+	InvalidLeader    = "invalid-leader"
+	InvalidTag       = "invalid-tag"
+	UnknownTag       = "unknown-tag"
+	ObsoleteTag      = "obsolete-tag"
+	MissingField     = "missing-field"
+	RepeatedField    = "repeated-field"
+	InvalidIndicator = "invalid-indicator"
+	UnknownSubField  = "unknown-subfield"
+	ObsoleteSubField = "obsolete-subfield"
+	RepeatedSubField = "repeated-subfield"
+	ControlCharacter = "control-character"
+	RuleViolation    = "rule-violation" // a broken local rule; see Rule
+)
+
+// ValidationIssue is a problem found in a record.
+type ValidationIssue struct {
+	Severity Severity `json:"severity"`
+	Kind     string   `json:"kind"`
+	Tag      string   `json:"tag,omitempty"`  // "LDR" for the leader; empty for the whole record
+	Index    int      `json:"index"`          // occurrence of the field among those with the same tag
+	Code     string   `json:"code,omitempty"` // subfield code
+	Rule     string   `json:"rule,omitempty"` // name of the broken rule
+	Message  string   `json:"message"`
+}
+
+// Location returns the location of the issue in MARCspec notation, ex.
+// "245[0]$c", or "" if the issue concerns the whole record.
+func (v ValidationIssue) Location() string {
+	switch v.Tag {
+	case "":
+		return ""
+	case "LDR":
+		return "LDR"
+	}
+	loc := v.Tag + "[" + strconv.Itoa(v.Index) + "]"
+	if v.Code != "" {
+		loc += "$" + v.Code
+	}
+	return loc
+}
+
+// String returns the issue as "severity location: message", or as
+// "severity rule name: message" for a broken rule.
+func (v ValidationIssue) String() string {
+	if v.Rule != "" {
+		return v.Severity.String() + " rule " + v.Rule + ": " + v.Message
+	}
+	if loc := v.Location(); loc != "" {
+		return v.Severity.String() + " " + loc + ": " + v.Message
+	}
+	return v.Severity.String() + ": " + v.Message
+}
+
+// Validator validates records against a dictionary. Validate may be called
+// concurrently, as long as the Validator and its dictionary are not modified.
+type Validator struct {
+	Dict *Dictionary
+
+	// Required are the tags of mandatory fields.
+	Required []string
+
+	// LocalTags are tag patterns (see marc.MatchTag) of fields reserved
+	// for local use. Unknown local fields are warnings rather than errors.
+	LocalTags []string
+}
+
+// NewValidator returns a Validator for the dictionary d, requiring 245 and
+// 008, and with 9XX and X9X reserved for local use.
+func NewValidator(d *Dictionary) *Validator {
+	return &Validator{
+		Dict:      d,
+		Required:  []string{"008", "245"},
+		LocalTags: []string{"9XX", "X9X"},
+	}
+}
+
+// Validate returns the issues found in r, in the order of the fields.
+// Leader and record issues come first.
+func (v *Validator) Validate(r *marc.Record) []ValidationIssue {
+	var issues issueList
+	add := issues.add
+
+	validateLeader(r, add)
+	for _, tag := range v.Required {
+		if len(r.MatchCFields(tag)) == 0 && len(r.IndexDFields(tag)) == 0 {
+			add(Error, MissingField, "", 0, "", "missing mandatory field %s", tag)
+		}
+	}
+
+	// MARC-8 (leader/09 blank) switches character sets with escape
+	// sequences.
+	marc8 := len(r.Leader) > 9 && r.Leader[9] != 'a'
+	seen := make(map[string]int) // occurrences of each tag
+	for _, f := range r.CtrlFields {
+		i := seen[f.Tag]
+		seen[f.Tag]++
+		def, ok := v.checkTag(f.Tag, i, true, add)
+		if ok && i == 1 && !def.Repeatable {
+			add(Error, RepeatedField, f.Tag, i, "", "non-repeatable field %s repeated", f.Tag)
+		}
+		if c, ok := controlChar(f.Value, marc8); ok {
+			add(Error, ControlCharacter, f.Tag, i, "", "control character %q in value", c)
+		}
+	}
+	for _, f := range r.DataFields {
+		i := seen[f.Tag]
+		seen[f.Tag]++
+		def, ok := v.checkTag(f.Tag, i, false, add)
+		if !ok {
+			for _, sf := range f.SubFields {
+				if c, ok := controlChar(sf.Value, marc8); ok {
+					add(Error, ControlCharacter, f.Tag, i, sf.Code, "control character %q in value", c)
+				}
+			}
+			continue
+		}
+		if i == 1 && !def.Repeatable {
+			add(Error, RepeatedField, f.Tag, i, "", "non-repeatable field %s repeated", f.Tag)
+		}
+		if f.Tag == "880" {
+			def = v.linkedField(def, f)
+		}
+		if !def.ValidInd1(f.Ind1) {
+			add(Error, InvalidIndicator, f.Tag, i, "", "invalid first indicator %q", f.Ind1)
+		}
+		if !def.ValidInd2(f.Ind2) {
+			add(Error, InvalidIndicator, f.Tag, i, "", "invalid second indicator %q", f.Ind2)
+		}
+		codes := make(map[string]int)
+		for _, sf := range f.SubFields {
+			codes[sf.Code]++
+			sdef, ok := def.SubField(sf.Code)
+			switch {
+			case !ok && codes[sf.Code] == 1:
+				add(Error, UnknownSubField, f.Tag, i, sf.Code, "unknown subfield $%s", sf.Code)
+			case ok && sdef.Obsolete && codes[sf.Code] == 1:
+				add(Warning, ObsoleteSubField, f.Tag, i, sf.Code, "obsolete subfield $%s (%s)", sf.Code, sdef.Name)
+			case ok && !sdef.Repeatable && codes[sf.Code] == 2:
+				add(Error, RepeatedSubField, f.Tag, i, sf.Code, "non-repeatable subfield $%s (%s) repeated", sf.Code, sdef.Name)
+			}
+			if c, ok := controlChar(sf.Value, marc8); ok {
+				add(Error, ControlCharacter, f.Tag, i, sf.Code, "control character %q in value", c)
+			}
+		}
+	}
+	return issues
+}
+
+// linkedField returns the definition of the field an 880 (alternate graphic
+// representation) is linked to by $6, ex. "245-01", or the definition of 880
+// if the linked field is unknown.
+func (v *Validator) linkedField(def *Field, f marc.DField) *Field {
+	link := f.SubField("6")
+	if len(link) < 3 {
+		return def
+	}
+	linked, ok := v.Dict.Field(link[:3])
+	if !ok || linked.IsControl() {
+		return def
+	}
+	if _, ok := linked.SubField("6"); ok {
+		return linked
+	}
+	m := *linked
+	m.SubFields = append(slices.Clone(linked.SubFields), def.SubFields...)
+	return &m
+}
+
+type issueList []ValidationIssue
+
+func (l *issueList) add(sev Severity, kind, tag string, index int, code, format string, args ...any) {
+	*l = append(*l, ValidationIssue{
+		Severity: sev,
+		Kind:     kind,
+		Tag:      tag,
+		Index:    index,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+type addFunc func(sev Severity, kind, tag string, index int, code, format string, args ...any)
+
+func validateLeader(r *marc.Record, add addFunc) {
+	if len(r.Leader) != 24 {
+		add(Error, InvalidLeader, "LDR", 0, "", "leader is %d characters; must be 24", len(r.Leader))
+		return
+	}
+	length, base := r.BinaryLengths()
+	checkNumber := func(name, s string, want int) {
+		if strings.TrimSpace(s) == "" {
+			return // not set, as in records decoded from line-MARC
+		}
+		n, err := strconv.Atoi(s)
+		switch {
+		case err != nil:
+			add(Error, InvalidLeader, "LDR", 0, "", "%s %q is not a number", name, s)
+		case n != want:
+			add(Warning, InvalidLeader, "LDR", 0, "", "%s is %d; record has %d", name, n, want)
+		}
+	}
+	checkNumber("record length", r.Leader[0:5], length)
+	checkNumber("base address of data", r.Leader[12:17], base)
+	if c, ok := controlChar(r.Leader, false); ok {
+		add(Error, ControlCharacter, "LDR", 0, "", "control character %q in leader", c)
+	}
+}
+
+// checkTag checks that a tag is well-formed, defined, and of the right kind
+// of field, and returns its definition if it is defined.
+func (v *Validator) checkTag(tag string, index int, control bool, add addFunc) (*Field, bool) {
+	if !validTag(tag) {
+		if index == 0 {
+			add(Error, InvalidTag, tag, index, "", "invalid tag %q", tag)
+		}
+		return nil, false
+	}
+	def, ok := v.Dict.Field(tag)
+	if !ok {
+		if index > 0 {
+			return nil, false
+		}
+		sev := Error
+		for _, p := range v.LocalTags {
+			if marc.MatchTag(p, tag) {
+				sev = Warning
+			}
+		}
+		add(sev, UnknownTag, tag, index, "", "unknown field %s", tag)
+		return nil, false
+	}
+	if def.IsControl() != control {
+		if index == 0 {
+			kind := "data"
+			if def.IsControl() {
+				kind = "control"
+			}
+			add(Error, InvalidTag, tag, index, "", "%s should be a %s field", tag, kind)
+		}
+		return nil, false
+	}
+	if def.Obsolete && index == 0 {
+		add(Warning, ObsoleteTag, tag, index, "", "obsolete field %s (%s)", tag, def.Name)
+	}
+	return def, true
+}
+
+func validTag(tag string) bool {
+	if len(tag) != 3 {
+		return false
+	}
+	for i := 0; i < 3; i++ {
+		c := tag[i]
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// controlChar returns the first control character (C0 or DEL) in s. With
+// marc8, ESC is allowed, as it starts MARC-8 escape sequences.
+func controlChar(s string, marc8 bool) (byte, bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0x1b && marc8 {
+			continue
+		}
+		if s[i] < 0x20 || s[i] == 0x7f {
+			return s[i], true
+		}
+	}
+	return 0, false
+}
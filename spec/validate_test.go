@@ -0,0 +1,104 @@
+package spec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/boutros/marc"
+)
+
+func TestValidate(t *testing.T) {
+	r := marc.NewRecord()
+	r.Leader = "00999cam  2200049 a 4500"
+	r.CtrlFields = marc.CFields{
+		{Tag: "001", Value: "1"},
+		{Tag: "001", Value: "2"},
+	}
+	r.DataFields = marc.DFields{
+		{Tag: "100", Ind1: "1", Ind2: "5", SubFields: marc.SubFields{{Code: "a", Value: "Doe, Jane"}}},
+		{Tag: "245", Ind1: "1", Ind2: "0", SubFields: marc.SubFields{
+			{Code: "a", Value: "Title"}, {Code: "a", Value: "Again"}, {Code: "x", Value: "?"}, {Code: "c", Value: "Doe\x1fx"},
+		}},
+		{Tag: "245", Ind1: "1", Ind2: "0", SubFields: marc.SubFields{{Code: "a", Value: "Other"}}},
+		{Tag: "440", Ind1: " ", Ind2: "0", SubFields: marc.SubFields{{Code: "a", Value: "Series"}}},
+		{Tag: "650", Ind1: " ", Ind2: "0", SubFields: marc.SubFields{{Code: "a", Value: "Cats"}}},
+		{Tag: "880", Ind1: "1", Ind2: "0", SubFields: marc.SubFields{{Code: "6", Value: "245-01"}, {Code: "c", Value: "Doe"}}},
+		{Tag: "950", SubFields: marc.SubFields{{Code: "a", Value: "Local"}}},
+		{Tag: "499", SubFields: marc.SubFields{{Code: "a", Value: "Local"}}},
+		{Tag: "123", SubFields: marc.SubFields{{Code: "a", Value: "Unknown"}}},
+		{Tag: "24", SubFields: marc.SubFields{{Code: "a", Value: "Bad tag"}}},
+	}
+
+	var got []string
+	for _, issue := range NewValidator(MARC21()).Validate(r) {
+		got = append(got, issue.Kind+" "+issue.String())
+	}
+	want := []string{
+		"invalid-leader warning LDR: record length is 999; record has 305",
+		"invalid-leader warning LDR: base address of data is 49; record has 169",
+		"missing-field error: missing mandatory field 008",
+		"repeated-field error 001[1]: non-repeatable field 001 repeated",
+		`invalid-indicator error 100[0]: invalid second indicator "5"`,
+		"repeated-subfield error 245[0]$a: non-repeatable subfield $a (Title) repeated",
+		"unknown-subfield error 245[0]$x: unknown subfield $x",
+		`control-character error 245[0]$c: control character '\x1f' in value`,
+		"repeated-field error 245[1]: non-repeatable field 245 repeated",
+		"obsolete-tag warning 440[0]: obsolete field 440 (Series Statement/Added Entry--Title)",
+		"unknown-tag warning 950[0]: unknown field 950",
+		"unknown-tag warning 499[0]: unknown field 499",
+		"unknown-tag error 123[0]: unknown field 123",
+		`invalid-tag error 24[0]: invalid tag "24"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate =>\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestValidateLeader(t *testing.T) {
+	tests := []struct {
+		leader string
+		want   []string
+	}{
+		{"     cam  22        4500", nil},
+		{"00044cam  2200037 a 4500", nil},
+		{"0005xcam  2200037 a 4500", []string{`record length "0005x" is not a number`}},
+		{"cam", []string{"leader is 3 characters; must be 24"}},
+	}
+	for _, tt := range tests {
+		r := marc.NewRecord()
+		r.Leader = tt.leader
+		r.AddDField(marc.DField{Tag: "245", Ind1: "0", Ind2: "0", SubFields: marc.SubFields{{Code: "a", Value: "T"}}})
+		v := &Validator{Dict: MARC21()}
+		var got []string
+		for _, issue := range v.Validate(r) {
+			got = append(got, issue.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Validate with leader %q => %q; want %q", tt.leader, got, tt.want)
+		}
+	}
+}
+
+func TestValidateEscape(t *testing.T) {
+	tests := []struct {
+		leader, value string
+		want          []string
+	}{
+		{"     cam  22        4500", "\x1b(3\x1bs", nil},
+		{"     cam a22        4500", "\x1b(3\x1bs", []string{`control character '\x1b' in value`}},
+		{"     cam  22        4500", "a\x1fb", []string{`control character '\x1f' in value`}},
+	}
+	for _, tt := range tests {
+		r := marc.NewRecord()
+		r.Leader = tt.leader
+		r.AddDField(marc.DField{Tag: "245", Ind1: "0", Ind2: "0", SubFields: marc.SubFields{{Code: "a", Value: tt.value}}})
+		v := &Validator{Dict: MARC21()}
+		var got []string
+		for _, issue := range v.Validate(r) {
+			got = append(got, issue.Message)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Validate %q with leader %q => %q; want %q", tt.value, tt.leader, got, tt.want)
+		}
+	}
+}